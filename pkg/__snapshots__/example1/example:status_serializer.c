@@ -5,6 +5,8 @@
 #include "example.pb.h"
 
 const uint32_t proto_message_size = sizeof(status);
+const char jbpf_io_schema_checksum[] = "954beb4d62a82f81eab788f0e64296265b7c56c6";
+const char jbpf_io_schema_msg_name[] = "status";
 
 int jbpf_io_serialize(void* input_msg_buf, size_t input_msg_buf_size, char* serialized_data_buf, size_t serialized_data_buf_size) {
 	if (input_msg_buf_size != proto_message_size)
@@ -5,6 +5,8 @@
 #include "example2.pb.h"
 
 const uint32_t proto_message_size = sizeof(item);
+const char jbpf_io_schema_checksum[] = "78ec55cdc102cdd208d44cfea99666129505762b";
+const char jbpf_io_schema_msg_name[] = "item";
 
 int jbpf_io_serialize(void* input_msg_buf, size_t input_msg_buf_size, char* serialized_data_buf, size_t serialized_data_buf_size) {
 	if (input_msg_buf_size != proto_message_size)
@@ -5,6 +5,8 @@
 #include "example3.pb.h"
 
 const uint32_t proto_message_size = sizeof(obj);
+const char jbpf_io_schema_checksum[] = "39cddf9e3df7ffacc34cb0fc7838632caf0c511c";
+const char jbpf_io_schema_msg_name[] = "obj";
 
 int jbpf_io_serialize(void* input_msg_buf, size_t input_msg_buf_size, char* serialized_data_buf, size_t serialized_data_buf_size) {
 	if (input_msg_buf_size != proto_message_size)
@@ -0,0 +1,29 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package config
+
+import (
+	"jbpf_protobuf_cli/cmd/config/header"
+	"jbpf_protobuf_cli/cmd/config/render"
+	"jbpf_protobuf_cli/cmd/config/schema"
+	"jbpf_protobuf_cli/cmd/config/validate"
+	"jbpf_protobuf_cli/common"
+
+	"github.com/spf13/cobra"
+)
+
+// Command returns the config commands
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Long:  "Execute a codeletset config subcommand.",
+		Short: "Execute a codeletset config subcommand",
+	}
+	cmd.AddCommand(
+		header.Command(opts),
+		render.Command(opts),
+		schema.Command(opts),
+		validate.Command(opts),
+	)
+	return cmd
+}
@@ -0,0 +1,123 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package header
+
+import (
+	"errors"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/header"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	defaultGuard = "JBPF_STREAMS_H"
+)
+
+type runOptions struct {
+	general *common.GeneralOptions
+	vars    *common.ConfigVariables
+
+	cTypeNames  map[common.ProtobufConfig]string
+	configFiles []string
+	guard       string
+	importPaths []string
+	output      string
+	prefix      string
+	sources     []*header.Source
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to generate the header from, in YAML, JSON or TOML, or - for stdin")
+	flags.StringVar(&opts.guard, "guard", "", "include guard of the header, will default to one derived from --output")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
+	flags.StringVarP(&opts.output, "output", "o", "", "header file to write, will default to stdout")
+	flags.StringVar(&opts.prefix, "prefix", "", "prefix added to every generated identifier")
+}
+
+func (o *runOptions) parse() error {
+	if len(o.configFiles) == 0 {
+		return errors.New("at least one config file must be provided")
+	}
+
+	configs, err := common.CodeletsetConfigFromFiles(o.vars, o.configFiles...)
+	if err != nil {
+		return err
+	}
+	o.sources = make([]*header.Source, len(configs))
+	for i, c := range configs {
+		o.sources[i] = &header.Source{Config: c, Path: common.ConfigDisplayName(c.Path)}
+	}
+
+	compiledProtos, err := common.LoadCompiledProtos(configs, o.importPaths, true, true)
+	if err != nil {
+		return err
+	}
+	o.cTypeNames, err = header.CTypeNames(configs, compiledProtos)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(o.guard) > 0:
+		o.guard = header.Identifier(o.guard)
+	case len(o.output) > 0:
+		o.guard = header.GuardFromFilename(o.output)
+	default:
+		o.guard = defaultGuard
+	}
+
+	return nil
+}
+
+// Command Generate a C header of stream UUID constants from codeletset configs
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		general: opts,
+		vars:    &common.ConfigVariables{},
+	}
+	cmd := &cobra.Command{
+		Use:   "header",
+		Short: "Generate a C header of stream UUID constants from codeletset configs",
+		Long:  "Generate a C header defining the stream UUID, as a string and a uint8_t[16], and the message type of each in/out io channel of the codeletset configs, so codelets stay in sync with their configs. The message type is the name of the struct nanopb generates, applying the .options file alongside the package_path.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.Flags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.Flags(), runOptions.vars)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.vars.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	data, err := header.Generate(opts.guard, opts.prefix, opts.sources, opts.cTypeNames)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.output) == 0 {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	absOutput, err := filepath.Abs(opts.output)
+	if err != nil {
+		return err
+	}
+	return common.WriteFileToDirectory(opts.general.Logger, filepath.Dir(absOutput), &common.File{
+		Data: data,
+		Mode: 0644,
+		Name: filepath.Base(absOutput),
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type runOptions struct {
+	general *common.GeneralOptions
+	vars    *common.ConfigVariables
+
+	configFiles []string
+	format      string
+	output      string
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to render, in YAML, JSON or TOML, or - for stdin")
+	flags.StringVar(&opts.format, "format", string(common.ConfigFormatYAML), "output format, set to yaml, json or toml. Several configs can only be rendered as yaml, as a stream of documents")
+	flags.StringVarP(&opts.output, "output", "o", "", "file to write, will default to stdout")
+}
+
+func (o *runOptions) parse() error {
+	if len(o.configFiles) == 0 {
+		return errors.New("at least one config file must be provided")
+	}
+	switch common.ConfigFormat(o.format) {
+	case common.ConfigFormatYAML:
+	case common.ConfigFormatJSON, common.ConfigFormatTOML:
+		if len(o.configFiles) > 1 {
+			return fmt.Errorf("only a single config can be rendered as %s, got %d", o.format, len(o.configFiles))
+		}
+	default:
+		return fmt.Errorf("unknown format %s, expected yaml, json or toml", o.format)
+	}
+	return nil
+}
+
+// Command Print codeletset configs with their variables expanded
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		general: opts,
+		vars:    &common.ConfigVariables{},
+	}
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Print codeletset configs with their variables expanded",
+		Long:  "Print codeletset configs as the other commands see them, with --set, --values and environment variables expanded in every string field, to check a templated config before it is deployed. Variables are only expanded in string fields, so numeric fields such as priority and runtime_threshold must be literal values.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.Flags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.Flags(), runOptions.vars)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.vars.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	rawConfigs, err := common.CodeletsetRawConfigFromFiles(opts.vars, opts.configFiles...)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for i, rawConfig := range rawConfigs {
+		data, err := common.MarshalCodeletsetRawConfig(rawConfig, common.ConfigFormat(opts.format))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		b.Write(data)
+	}
+
+	if len(opts.output) == 0 {
+		_, err := cmd.OutOrStdout().Write(b.Bytes())
+		return err
+	}
+
+	absOutput, err := filepath.Abs(opts.output)
+	if err != nil {
+		return err
+	}
+	return common.WriteFileToDirectory(opts.general.Logger, filepath.Dir(absOutput), &common.File{
+		Data: b.Bytes(),
+		Mode: 0644,
+		Name: filepath.Base(absOutput),
+	})
+}
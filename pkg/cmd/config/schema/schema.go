@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package schema
+
+import (
+	"errors"
+	"jbpf_protobuf_cli/common"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type runOptions struct {
+	general *common.GeneralOptions
+
+	output string
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringVarP(&opts.output, "output", "o", "", "JSON Schema file to write, will default to stdout")
+}
+
+// Command Print the JSON Schema of codeletset configs
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		general: opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of codeletset configs",
+		Long:  "Print the JSON Schema of codeletset configs, for editors to validate and complete YAML, JSON and TOML configs as they are written.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.Flags(), runOptions)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+	); err != nil {
+		return err
+	}
+
+	data, err := common.CodeletsetConfigJSONSchema()
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if len(opts.output) == 0 {
+		_, err := cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	absOutput, err := filepath.Abs(opts.output)
+	if err != nil {
+		return err
+	}
+	return common.WriteFileToDirectory(opts.general.Logger, filepath.Dir(absOutput), &common.File{
+		Data: data,
+		Mode: 0644,
+		Name: filepath.Base(absOutput),
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type runOptions struct {
+	general *common.GeneralOptions
+	vars    *common.ConfigVariables
+
+	configFiles []string
+	importPaths []string
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to validate, in YAML, JSON or TOML, or - for stdin")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
+}
+
+func (o *runOptions) parse() (err error) {
+	if len(o.configFiles) == 0 {
+		return errors.New("at least one config file must be provided")
+	}
+	o.configFiles, err = common.ExpandConfigPaths(o.configFiles)
+	return
+}
+
+// Command Validate codeletset configs
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		general: opts,
+		vars:    &common.ConfigVariables{},
+	}
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate codeletset configs",
+		Long:  "Check codeletset configs and report every problem with its line and column: unknown fields, missing or unparsable stream IDs, stream IDs used by more than one channel across all the configs, referenced files which do not exist, msg_name not defined in the package_path descriptor and unset environment variables.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.Flags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.Flags(), runOptions.vars)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.vars.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	problems := common.ValidateCodeletsetConfigFiles(opts.configFiles, opts.importPaths, opts.vars)
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in %d config file(s)", len(problems), len(opts.configFiles))
+	}
+	fmt.Fprintf(out, "%d config file(s) are valid\n", len(opts.configFiles))
+	return nil
+}
@@ -5,6 +5,7 @@ package decoder
 import (
 	"jbpf_protobuf_cli/cmd/decoder/load"
 	"jbpf_protobuf_cli/cmd/decoder/run"
+	"jbpf_protobuf_cli/cmd/decoder/status"
 	"jbpf_protobuf_cli/cmd/decoder/unload"
 	"jbpf_protobuf_cli/common"
 
@@ -22,6 +23,7 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 		load.Command(opts),
 		unload.Command(opts),
 		run.Command(opts),
+		status.Command(opts),
 	)
 	return cmd
 }
@@ -4,6 +4,7 @@ package load
 
 import (
 	"errors"
+	"fmt"
 	"jbpf_protobuf_cli/common"
 	"jbpf_protobuf_cli/schema"
 
@@ -15,22 +16,27 @@ import (
 type runOptions struct {
 	decoderAPI *schema.Options
 	general    *common.GeneralOptions
+	vars       *common.ConfigVariables
 
-	compiledProtos map[string]*common.File
-	configFiles    []string
-	configs        []*common.CodeletsetConfig
+	compiledProtos     map[string]*common.File
+	configFiles        []string
+	configs            []*common.CodeletsetConfig
+	importPaths        []string
+	rejectIncompatible bool
 }
 
 func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
-	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files to load")
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to load, in YAML, JSON or TOML, or - for stdin")
+	flags.BoolVar(&opts.rejectIncompatible, "reject-incompatible", false, "fail instead of replacing a loaded proto package with one which has breaking changes to the messages of streams still associated with it, see \"serde diff\"")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
 }
 
 func (o *runOptions) parse() (err error) {
-	o.configs, err = common.CodeletsetConfigFromFiles(o.configFiles...)
+	o.configs, err = common.CodeletsetConfigFromFiles(o.vars, o.configFiles...)
 	if err != nil {
 		return
 	}
-	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, false, true)
+	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, o.importPaths, false, true)
 	return
 }
 
@@ -39,17 +45,19 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 	runOptions := &runOptions{
 		decoderAPI: &schema.Options{},
 		general:    opts,
+		vars:       &common.ConfigVariables{},
 	}
 	cmd := &cobra.Command{
 		Use:   "load",
 		Short: "Load a schema to a local decoder",
-		Long:  "Load a schema to a local decoder",
+		Long:  "Load the schemas and out io channel stream associations of the configs to a local decoder. Each codeletset is loaded all together or not at all, replacing what it loaded before, while the streams of configs without a codeletset_id are loaded one by one.",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			return run(cmd, runOptions)
 		},
 		SilenceUsage: true,
 	}
 	addToFlags(cmd.PersistentFlags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.PersistentFlags(), runOptions.vars)
 	schema.AddOptionsToFlags(cmd.PersistentFlags(), runOptions.decoderAPI)
 	return cmd
 }
@@ -58,40 +66,114 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 	if err := errors.Join(
 		opts.general.Parse(),
 		opts.decoderAPI.Parse(),
+		opts.vars.Parse(),
 		opts.parse(),
 	); err != nil {
 		return err
 	}
 
-	logger := opts.general.Logger
+	codeletsets, schemas, err := opts.requests()
+	if err != nil {
+		return err
+	}
 
-	client, err := schema.NewClient(cmd.Context(), logger, opts.decoderAPI)
+	client, err := schema.NewClient(cmd.Context(), opts.general.Logger, opts.decoderAPI)
 	if err != nil {
 		return err
 	}
 
+	errs := make([]error, 0, len(codeletsets)+1)
+	for _, req := range codeletsets {
+		errs = append(errs, client.LoadCodeletset(req))
+	}
+	if len(schemas) > 0 {
+		errs = append(errs, client.Load(schemas))
+	}
+	return errors.Join(errs...)
+}
+
+// requests groups the out io channels of the configs into the requests sent to the decoder. Configs sharing a
+// codeletset ID are loaded together, configs without protobuf out io channels are skipped, and the schemas and streams
+// of configs without a codeletset ID are loaded one by one. Streams are tagged with the codelet name either way.
+func (o *runOptions) requests() ([]*schema.LoadCodeletsetRequest, map[string]*schema.LoadRequest, error) {
+	codeletsets := make([]*schema.LoadCodeletsetRequest, 0)
+	byID := make(map[string]*schema.LoadCodeletsetRequest)
 	schemas := make(map[string]*schema.LoadRequest)
+	protoPackages := make(map[string]string)
+	// loaded and associated record the package paths and streams already in each codeletset request, as the same
+	// stream may appear in several configs
+	loaded := make(map[[2]string]bool)
+	associated := make(map[[2]string]bool)
 
-	for _, config := range opts.configs {
+	for _, config := range o.configs {
 		for _, desc := range config.CodeletDescriptor {
 			for _, io := range desc.OutIOChannel {
-				if existing, ok := schemas[io.Serde.Protobuf.PackageName]; ok {
-					existing.Streams[io.StreamUUID] = io.Serde.Protobuf.MsgName
-				} else {
-					compiledProto, ok := opts.compiledProtos[io.Serde.Protobuf.PackagePath]
-					if !ok {
-						return errors.New("compiled proto not found")
+				if !io.HasProtobuf() {
+					continue
+				}
+				if len(config.CodeletsetID) == 0 {
+					if err := o.addLoadRequest(schemas, desc.CodeletName, io); err != nil {
+						return nil, nil, err
 					}
-					schemas[io.Serde.Protobuf.PackageName] = &schema.LoadRequest{
-						CompiledProto: compiledProto.Data,
-						Streams: map[uuid.UUID]string{
-							io.StreamUUID: io.Serde.Protobuf.MsgName,
-						},
+					continue
+				}
+				req, ok := byID[config.CodeletsetID]
+				if !ok {
+					req = &schema.LoadCodeletsetRequest{CodeletsetID: config.CodeletsetID}
+					byID[config.CodeletsetID] = req
+					codeletsets = append(codeletsets, req)
+				}
+				compiledProto, ok := o.compiledProtos[io.Serde.Protobuf.PackagePath]
+				if !ok {
+					return nil, nil, errors.New("compiled proto not found")
+				}
+				protoPackage, ok := protoPackages[io.Serde.Protobuf.PackagePath]
+				if !ok {
+					var err error
+					if protoPackage, err = schema.PackageIDFromDescriptor(compiledProto.Data); err != nil {
+						return nil, nil, fmt.Errorf("failed to interpret %s: %w", io.Serde.Protobuf.PackagePath, err)
 					}
+					protoPackages[io.Serde.Protobuf.PackagePath] = protoPackage
+				}
+				if key := [2]string{config.CodeletsetID, io.Serde.Protobuf.PackagePath}; !loaded[key] {
+					loaded[key] = true
+					req.ProtoPackages = append(req.ProtoPackages, &schema.UpsertSchemaRequest{
+						ProtoDescriptor:    compiledProto.Data,
+						RejectIncompatible: o.rejectIncompatible,
+					})
+				}
+				if key := [2]string{config.CodeletsetID, io.StreamUUID.String()}; !associated[key] {
+					associated[key] = true
+					req.Streams = append(req.Streams, &schema.AddSchemaAssociationRequest{
+						StreamUUID:   io.StreamUUID,
+						ProtoPackage: protoPackage,
+						ProtoMessage: io.Serde.Protobuf.MsgName,
+						CodeletName:  desc.CodeletName,
+					})
 				}
 			}
 		}
 	}
 
-	return client.Load(schemas)
+	return codeletsets, schemas, nil
+}
+
+func (o *runOptions) addLoadRequest(schemas map[string]*schema.LoadRequest, codeletName string, io *common.IOChannelConfig) error {
+	stream := &schema.LoadStream{CodeletName: codeletName, ProtoMessage: io.Serde.Protobuf.MsgName}
+	if existing, ok := schemas[io.Serde.Protobuf.PackagePath]; ok {
+		existing.Streams[io.StreamUUID] = stream
+		return nil
+	}
+	compiledProto, ok := o.compiledProtos[io.Serde.Protobuf.PackagePath]
+	if !ok {
+		return errors.New("compiled proto not found")
+	}
+	schemas[io.Serde.Protobuf.PackagePath] = &schema.LoadRequest{
+		CompiledProto:      compiledProto.Data,
+		RejectIncompatible: o.rejectIncompatible,
+		Streams: map[uuid.UUID]*schema.LoadStream{
+			io.StreamUUID: stream,
+		},
+	}
+	return nil
 }
@@ -0,0 +1,62 @@
+package load
+
+import (
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/schema"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snapshotDir = "../../../__snapshots__"
+
+func TestRequestsTagStreamsWithCodeletName(t *testing.T) {
+	pb, err := filepath.Abs(filepath.Join(snapshotDir, "example1", "example.pb"))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	config := func(name, codeletsetID, streamID string) string {
+		path := filepath.Join(dir, name)
+		data := "codelet_descriptor:\n  - codelet_name: " + name + "_codelet\n    out_io_channel:\n      - stream_id: " + streamID +
+			"\n        serde:\n          protobuf:\n            package_path: " + pb + "\n            msg_name: status\n"
+		if len(codeletsetID) > 0 {
+			data = "codeletset_id: " + codeletsetID + "\n" + data
+		}
+		require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+		return path
+	}
+
+	opts := &runOptions{
+		vars: &common.ConfigVariables{},
+		configFiles: []string{
+			config("tagged.yaml", "cs", "00000000-0000-0000-0000-000000000001"),
+			config("untagged.yaml", "", "00000000-0000-0000-0000-000000000002"),
+		},
+	}
+	require.NoError(t, opts.vars.Parse())
+	require.NoError(t, opts.parse())
+
+	codeletsets, schemas, err := opts.requests()
+	require.NoError(t, err)
+
+	// streams of a codeletset are loaded with it
+	require.Len(t, codeletsets, 1)
+	assert.Equal(t, "cs", codeletsets[0].CodeletsetID)
+	require.Len(t, codeletsets[0].ProtoPackages, 1)
+	assert.Equal(t, []*schema.AddSchemaAssociationRequest{{
+		CodeletName:  "tagged.yaml_codelet",
+		ProtoMessage: "status",
+		ProtoPackage: "example.proto",
+		StreamUUID:   uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+	}}, codeletsets[0].Streams)
+
+	// streams of configs without a codeletset ID are still tagged with their codelet
+	require.Len(t, schemas, 1)
+	require.Contains(t, schemas, pb)
+	assert.Equal(t, map[uuid.UUID]*schema.LoadStream{
+		uuid.MustParse("00000000-0000-0000-0000-000000000002"): {CodeletName: "untagged.yaml_codelet", ProtoMessage: "status"},
+	}, schemas[pb].Streams)
+}
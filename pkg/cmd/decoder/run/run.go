@@ -8,7 +8,6 @@ import (
 	"jbpf_protobuf_cli/data"
 	"jbpf_protobuf_cli/schema"
 
-	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
@@ -64,10 +63,18 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 	g, _ := errgroup.WithContext(cmd.Context())
 
 	g.Go(func() error {
-		return dataServer.Listen(func(streamUUID uuid.UUID, data []byte) {
-			logger.WithFields(logrus.Fields{
-				"streamUUID": streamUUID.String(),
-			}).Info(string(data))
+		return dataServer.Listen(func(msg *schema.DecodedMessage, data []byte) {
+			fields := logrus.Fields{
+				"streamUUID": msg.StreamUUID.String(),
+			}
+			// streams associated without a codeletset are not tagged
+			if len(msg.CodeletsetID) > 0 {
+				fields["codeletsetID"] = msg.CodeletsetID
+			}
+			if len(msg.CodeletName) > 0 {
+				fields["codeletName"] = msg.CodeletName
+			}
+			logger.WithFields(fields).Info(string(data))
 		})
 	})
 
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/schema"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	formatJSON = "json"
+	formatText = "text"
+)
+
+type runOptions struct {
+	decoderAPI *schema.Options
+	general    *common.GeneralOptions
+
+	codeletsetID string
+	format       string
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringVar(&opts.codeletsetID, "codeletset-id", "", "only show the streams of this codeletset")
+	flags.StringVar(&opts.format, "format", formatText, "output format, set to text or json")
+}
+
+func (o *runOptions) parse() error {
+	if o.format != formatJSON && o.format != formatText {
+		return fmt.Errorf("invalid format: %s", o.format)
+	}
+	return nil
+}
+
+// Command Show the streams loaded in a local decoder
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		decoderAPI: &schema.Options{},
+		general:    opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the streams loaded in a local decoder",
+		Long:  "Show the stream associations of a local decoder grouped by codeletset, with the number of messages decoded and failed to decode for each stream.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.PersistentFlags(), runOptions)
+	schema.AddOptionsToFlags(cmd.PersistentFlags(), runOptions.decoderAPI)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.decoderAPI.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	client, err := schema.NewClient(cmd.Context(), opts.general.Logger, opts.decoderAPI)
+	if err != nil {
+		return err
+	}
+
+	status, err := client.Status(opts.codeletsetID)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+
+	if opts.format == formatJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+		return nil
+	}
+
+	for _, cs := range status.Codeletsets {
+		if len(cs.CodeletsetID) > 0 {
+			fmt.Fprintf(out, "codeletset %s\n", cs.CodeletsetID)
+		} else {
+			fmt.Fprintln(out, "streams without a codeletset")
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  STREAM\tCODELET\tMESSAGE\tPACKAGE\tDECODED\tFAILED")
+		for _, stream := range cs.Streams {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d\t%d\n", stream.StreamUUID, stream.CodeletName, stream.ProtoMessage, stream.ProtoPackage, stream.Decoded, stream.Failed)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(opts.codeletsetID) == 0 {
+		fmt.Fprintf(out, "messages for unknown streams: %d\n", status.UnknownStreamMessages)
+	}
+
+	return nil
+}
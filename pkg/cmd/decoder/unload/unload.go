@@ -6,30 +6,53 @@ import (
 	"errors"
 	"jbpf_protobuf_cli/common"
 	"jbpf_protobuf_cli/schema"
+	"net/http"
+	"sort"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
-const (
-	maxStreamUUIDs = 1024
-)
-
 type runOptions struct {
 	decoderAPI *schema.Options
 	general    *common.GeneralOptions
+	vars       *common.ConfigVariables
 
-	configFiles []string
-	configs     []*common.CodeletsetConfig
+	cascade        bool
+	codeletsetIDs  []string
+	compiledProtos map[string]*common.File
+	configFiles    []string
+	configs        []*common.CodeletsetConfig
+	importPaths    []string
+	prune          bool
+	schemas        bool
 }
 
 func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
-	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files to unload")
+	flags.BoolVar(&opts.cascade, "cascade", false, "with --schemas, also remove the associations of streams of other configs still using the proto packages, instead of refusing to remove them")
+	flags.StringArrayVar(&opts.codeletsetIDs, "codeletset-id", []string{}, "ID of a codeletset to unload, without its config")
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to unload, in YAML, JSON or TOML, or - for stdin")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
+	flags.BoolVar(&opts.prune, "prune", false, "after unloading, remove every proto package which no stream is associated with anymore")
+	flags.BoolVar(&opts.schemas, "schemas", false, "also remove the proto packages of the configs, refused while streams of other configs still use them unless --cascade is set")
 }
 
 func (o *runOptions) parse() (err error) {
-	o.configs, err = common.CodeletsetConfigFromFiles(o.configFiles...)
+	if o.cascade && !o.schemas {
+		return errors.New("--cascade requires --schemas")
+	}
+	if o.schemas && len(o.configFiles) == 0 {
+		return errors.New("--schemas requires at least one config file")
+	}
+	if len(o.configFiles) == 0 && len(o.codeletsetIDs) == 0 && !o.prune {
+		return errors.New("at least one config file or codeletset ID must be provided, unless pruning")
+	}
+	o.configs, err = common.CodeletsetConfigFromFiles(o.vars, o.configFiles...)
+	if err != nil || !o.schemas {
+		return
+	}
+	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, o.importPaths, false, true)
 	return
 }
 
@@ -38,17 +61,19 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 	runOptions := &runOptions{
 		decoderAPI: &schema.Options{},
 		general:    opts,
+		vars:       &common.ConfigVariables{},
 	}
 	cmd := &cobra.Command{
 		Use:   "unload",
 		Short: "Unload a schema from a local decoder",
-		Long:  "Unload a schema from a local decoder",
+		Long:  "Unload the codeletsets of the configs, or given by ID, from a local decoder, removing what loading them added, or the associations of their out io channel streams if they were not loaded as a whole. With --schemas the proto packages of the configs are removed too, and with --prune every proto package no longer associated with a stream.",
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			return run(cmd, runOptions)
 		},
 		SilenceUsage: true,
 	}
 	addToFlags(cmd.PersistentFlags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.PersistentFlags(), runOptions.vars)
 	schema.AddOptionsToFlags(cmd.PersistentFlags(), runOptions.decoderAPI)
 	return cmd
 }
@@ -57,6 +82,7 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 	if err := errors.Join(
 		opts.general.Parse(),
 		opts.decoderAPI.Parse(),
+		opts.vars.Parse(),
 		opts.parse(),
 	); err != nil {
 		return err
@@ -69,15 +95,79 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 		return err
 	}
 
-	streamUUIDs := make([]uuid.UUID, 0, maxStreamUUIDs)
+	codeletsetIDs := make([]string, 0)
+	streamUUIDs := make(map[string][]uuid.UUID)
+	seen := make(map[uuid.UUID]bool)
+	packagePaths := make(map[string]bool)
 
 	for _, config := range opts.configs {
+		if _, ok := streamUUIDs[config.CodeletsetID]; !ok {
+			codeletsetIDs = append(codeletsetIDs, config.CodeletsetID)
+			streamUUIDs[config.CodeletsetID] = make([]uuid.UUID, 0)
+		}
 		for _, desc := range config.CodeletDescriptor {
 			for _, io := range desc.OutIOChannel {
-				streamUUIDs = append(streamUUIDs, io.StreamUUID)
+				// the same stream may appear in several configs
+				if !seen[io.StreamUUID] {
+					seen[io.StreamUUID] = true
+					streamUUIDs[config.CodeletsetID] = append(streamUUIDs[config.CodeletsetID], io.StreamUUID)
+				}
+				if io.HasProtobuf() {
+					packagePaths[io.Serde.Protobuf.PackagePath] = true
+				}
+			}
+		}
+	}
+
+	for _, codeletsetID := range opts.codeletsetIDs {
+		if err := client.UnloadCodeletset(codeletsetID); err != nil {
+			return err
+		}
+	}
+
+	for _, codeletsetID := range codeletsetIDs {
+		if len(codeletsetID) > 0 {
+			err := client.UnloadCodeletset(codeletsetID)
+			var statusErr *schema.StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			// the codeletset was not loaded as a whole, as by older versions of decoder load, so its streams are
+			// unloaded one by one
+			logger.WithField("codeletsetID", codeletsetID).Info("codeletset not loaded, deleting its stream associations")
+		}
+		if err := client.Unload(streamUUIDs[codeletsetID]); err != nil {
+			return err
+		}
+	}
+
+	if opts.schemas {
+		protoPackages := make([]string, 0, len(packagePaths))
+		for packagePath := range packagePaths {
+			compiledProto, ok := opts.compiledProtos[packagePath]
+			if !ok {
+				return errors.New("compiled proto not found")
+			}
+			protoPackage, err := schema.PackageIDFromDescriptor(compiledProto.Data)
+			if err != nil {
+				return err
 			}
+			protoPackages = append(protoPackages, protoPackage)
+		}
+		sort.Strings(protoPackages)
+		if err := client.DeleteSchemas(protoPackages, opts.cascade); err != nil {
+			return err
+		}
+	}
+
+	if opts.prune {
+		if _, err := client.PruneSchemas(); err != nil {
+			return err
 		}
 	}
 
-	return client.Unload(streamUUIDs)
+	return nil
 }
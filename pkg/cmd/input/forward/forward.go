@@ -16,19 +16,18 @@ import (
 	"github.com/spf13/pflag"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
-	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 type runOptions struct {
 	jbpf    *jbpf.Options
 	general *common.GeneralOptions
+	vars    *common.ConfigVariables
 
 	compiledProtos map[string]*common.File
 	configFiles    []string
 	configs        []*common.CodeletsetConfig
+	importPaths    []string
 	filePath       string
 	inlineJSON     string
 	payload        string
@@ -37,7 +36,8 @@ type runOptions struct {
 }
 
 func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
-	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files to load")
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to load, in YAML, JSON or TOML, or - for stdin")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
 	flags.StringVar(&opts.streamID, "stream-id", "00000000-0000-0000-0000-000000000000", "stream ID")
 	flags.StringVarP(&opts.filePath, "file", "f", "", "path to file containing payload in JSON format")
 	flags.StringVarP(&opts.inlineJSON, "inline-json", "j", "", "inline payload in JSON format")
@@ -54,12 +54,12 @@ func (o *runOptions) parse() (err error) {
 		return
 	}
 
-	o.configs, err = common.CodeletsetConfigFromFiles(o.configFiles...)
+	o.configs, err = common.CodeletsetConfigFromFiles(o.vars, o.configFiles...)
 	if err != nil {
 		return
 	}
 
-	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, true, false)
+	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, o.importPaths, true, false)
 	return
 }
 
@@ -68,6 +68,7 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 	runOptions := &runOptions{
 		jbpf:    &jbpf.Options{},
 		general: opts,
+		vars:    &common.ConfigVariables{},
 	}
 	cmd := &cobra.Command{
 		Use:   "forward",
@@ -79,6 +80,7 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 		SilenceUsage: true,
 	}
 	addToFlags(cmd.PersistentFlags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.PersistentFlags(), runOptions.vars)
 	jbpf.AddOptionsToFlags(cmd.PersistentFlags(), runOptions.jbpf)
 	return cmd
 }
@@ -87,6 +89,7 @@ func run(_ *cobra.Command, opts *runOptions) error {
 	if err := errors.Join(
 		opts.general.Parse(),
 		opts.jbpf.Parse(),
+		opts.vars.Parse(),
 		opts.parse(),
 	); err != nil {
 		return err
@@ -156,39 +159,15 @@ func loadInlineJSONOrFromFile(inlineJSON, filePath string) (string, error) {
 }
 
 func getMessageInstance(configs []*common.CodeletsetConfig, compiledProtos map[string]*common.File, streamUUID uuid.UUID) (*dynamicpb.Message, error) {
-	for _, config := range configs {
-		for _, desc := range config.CodeletDescriptor {
-			for _, io := range desc.InIOChannel {
-				if io.StreamUUID == streamUUID {
-					compiledProto := compiledProtos[io.Serde.Protobuf.PackagePath]
-
-					fds := &descriptorpb.FileDescriptorSet{}
-					if err := proto.Unmarshal(compiledProto.Data, fds); err != nil {
-						return nil, err
-					}
-
-					pd, err := protodesc.NewFiles(fds)
-					if err != nil {
-						return nil, err
-					}
-
-					msgName := protoreflect.FullName(io.Serde.Protobuf.MsgName)
-					var desc protoreflect.Descriptor
-					desc, err = pd.FindDescriptorByName(msgName)
-					if err != nil {
-						return nil, err
-					}
-
-					md, ok := desc.(protoreflect.MessageDescriptor)
-					if !ok {
-						return nil, fmt.Errorf("failed to cast desc to protoreflect.MessageDescriptor, got %T", desc)
-					}
-
-					return dynamicpb.NewMessage(md), nil
-				}
-			}
-		}
+	io, err := common.FindInIOChannel(configs, streamUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := common.FindMessageDescriptor(compiledProtos[io.Serde.Protobuf.PackagePath].Data, io.Serde.Protobuf.MsgName)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("stream %s not found in any of the loaded schemas", streamUUID)
+	return dynamicpb.NewMessage(md), nil
 }
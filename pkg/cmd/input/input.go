@@ -4,6 +4,7 @@ package input
 
 import (
 	"jbpf_protobuf_cli/cmd/input/forward"
+	"jbpf_protobuf_cli/cmd/input/template"
 	"jbpf_protobuf_cli/common"
 
 	"github.com/spf13/cobra"
@@ -18,6 +19,7 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 	}
 	cmd.AddCommand(
 		forward.Command(opts),
+		template.Command(opts),
 	)
 	return cmd
 }
@@ -0,0 +1,109 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package template
+
+import (
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"jbpf_protobuf_cli/generator/sample"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type runOptions struct {
+	general *common.GeneralOptions
+	sample  *sample.Options
+	vars    *common.ConfigVariables
+
+	compiledProtos map[string]*common.File
+	configFiles    []string
+	configs        []*common.CodeletsetConfig
+	importPaths    []string
+	streamID       string
+	streamUUID     uuid.UUID
+}
+
+func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.StringArrayVarP(&opts.configFiles, "config", "c", []string{}, "configuration files, directories or glob patterns to load, in YAML, JSON or TOML, or - for stdin")
+	flags.StringArrayVarP(&opts.importPaths, "proto-path", "I", []string{}, "directories to search for imports when a package_path is a .proto source, after the directory of the source itself")
+	flags.StringVar(&opts.streamID, "stream-id", "00000000-0000-0000-0000-000000000000", "stream ID")
+}
+
+func (o *runOptions) parse() (err error) {
+	o.streamUUID, err = uuid.Parse(o.streamID)
+	if err != nil {
+		return
+	}
+
+	o.configs, err = common.CodeletsetConfigFromFiles(o.vars, o.configFiles...)
+	if err != nil {
+		return
+	}
+
+	o.compiledProtos, err = common.LoadCompiledProtos(o.configs, o.importPaths, true, false)
+	return
+}
+
+// Command Generate a sample payload for an input stream
+func Command(opts *common.GeneralOptions) *cobra.Command {
+	runOptions := &runOptions{
+		general: opts,
+		sample:  &sample.Options{},
+		vars:    &common.ConfigVariables{},
+	}
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Generate a sample payload for an input stream",
+		Long:  "Generate a JSON payload for the message of an input stream, which can be edited and passed to `input forward`. The max_size and max_count of fields are read from the .options file alongside the stream's package_path, if it exists.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd, runOptions)
+		},
+		SilenceUsage: true,
+	}
+	addToFlags(cmd.PersistentFlags(), runOptions)
+	common.AddConfigVariablesToFlags(cmd.PersistentFlags(), runOptions.vars)
+	sample.AddOptionsToFlags(cmd.PersistentFlags(), runOptions.sample)
+	return cmd
+}
+
+func run(cmd *cobra.Command, opts *runOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.sample.Parse(),
+		opts.vars.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	io, err := common.FindInIOChannel(opts.configs, opts.streamUUID)
+	if err != nil {
+		return err
+	}
+
+	protobuf := io.Serde.Protobuf
+	md, err := common.FindMessageDescriptor(opts.compiledProtos[protobuf.PackagePath].Data, protobuf.MsgName)
+	if err != nil {
+		return err
+	}
+
+	nanopbOpts, err := nanopb.LoadOptionsForProto(protobuf.PackagePath)
+	if err != nil {
+		return err
+	}
+
+	if opts.sample.Random() {
+		opts.general.Logger.WithField("seed", opts.sample.Seed()).Debug("generating random sample")
+	}
+
+	data, err := sample.Marshal(sample.Generate(opts.sample, nanopbOpts, md))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return err
+}
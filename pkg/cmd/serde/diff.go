@@ -0,0 +1,127 @@
+package serde
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/schema"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+type diffOptions struct {
+	general *common.GeneralOptions
+
+	format   string
+	msgNames []string
+	newFiles *protoregistry.Files
+	newPath  string
+	oldFiles *protoregistry.Files
+	oldPath  string
+}
+
+func addDiffToFlags(flags *pflag.FlagSet, opts *diffOptions) {
+	flags.StringArrayVar(&opts.msgNames, "msg", []string{}, "full name(s) of the messages to compare, along with the messages and enums they reference. Will default to every message and enum of the old package")
+	flags.StringVar(&opts.format, "format", formatText, "output format, set to text or json")
+}
+
+func (o *diffOptions) parse(args []string) error {
+	if o.format != formatJSON && o.format != formatText {
+		return fmt.Errorf("invalid format: %s", o.format)
+	}
+
+	o.oldPath, o.newPath = args[0], args[1]
+	load := func(path string) (*protoregistry.Files, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files, err := schema.ParseFiles(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to interpret %s: %w", path, err)
+		}
+		return files, nil
+	}
+
+	var err1, err2 error
+	o.oldFiles, err1 = load(o.oldPath)
+	o.newFiles, err2 = load(o.newPath)
+	return errors.Join(err1, err2)
+}
+
+func diffCommand(opts *common.GeneralOptions) *cobra.Command {
+	diffOptions := &diffOptions{
+		general: opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "diff <old.pb> <new.pb>",
+		Short: "Compare two versions of a compiled proto package",
+		Long:  "Compare two versions of a compiled proto package and report which changes are wire-breaking, such as field number reuse, type changes, new required fields and removed enum values, and which are safe. Fails if there are any breaking changes, so data written by codelets built against the old version could be silently mis-decoded with the new version.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(cmd, args, diffOptions)
+		},
+		SilenceUsage: true,
+	}
+	addDiffToFlags(cmd.Flags(), diffOptions)
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string, opts *diffOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.parse(args),
+	); err != nil {
+		return err
+	}
+
+	var changes []*schema.Change
+	if len(opts.msgNames) > 0 {
+		for _, msgName := range opts.msgNames {
+			if _, err := opts.oldFiles.FindDescriptorByName(protoreflect.FullName(msgName)); err != nil {
+				return fmt.Errorf("message %s not found in %s: %w", msgName, opts.oldPath, err)
+			}
+		}
+		changes = schema.DiffMessages(opts.oldFiles, opts.newFiles, opts.msgNames)
+	} else {
+		changes = schema.Diff(opts.oldFiles, opts.newFiles)
+	}
+
+	out := cmd.OutOrStdout()
+	breaking := 0
+	for _, c := range changes {
+		if c.Breaking {
+			breaking++
+		}
+		if opts.format != formatText {
+			continue
+		}
+		kind := "safe"
+		if c.Breaking {
+			kind = "breaking"
+		}
+		fmt.Fprintf(out, "%s: %s\n", kind, c)
+	}
+
+	if opts.format == formatText && len(changes) == 0 {
+		fmt.Fprintf(out, "no changes from %s to %s\n", opts.oldPath, opts.newPath)
+	}
+
+	if opts.format == formatJSON {
+		data, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	}
+
+	if breaking > 0 {
+		return fmt.Errorf("%d breaking change(s) from %s to %s", breaking, opts.oldPath, opts.newPath)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package serde
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/stream"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type inspectOptions struct {
+	general *common.GeneralOptions
+
+	format      string
+	pbChecksum  string
+	pbPath      string
+	serializers []string
+}
+
+type inspectReport struct {
+	Checksum    string
+	Matches     *bool `json:",omitempty"`
+	MessageName string
+	Serializer  string
+}
+
+func addInspectToFlags(flags *pflag.FlagSet, opts *inspectOptions) {
+	flags.StringVar(&opts.format, "format", formatText, "output format, set to text or json")
+	flags.StringVar(&opts.pbPath, "pb", "", "compiled proto package to compare the serializers against, fails if any serializer was not generated from it")
+}
+
+func (o *inspectOptions) parse(args []string) error {
+	if o.format != formatJSON && o.format != formatText {
+		return fmt.Errorf("invalid format: %s", o.format)
+	}
+
+	o.serializers = args
+
+	if len(o.pbPath) > 0 {
+		data, err := os.ReadFile(o.pbPath)
+		if err != nil {
+			return err
+		}
+		o.pbChecksum = fmt.Sprintf("%x", sha1.Sum(data))
+	}
+
+	return nil
+}
+
+func inspectCommand(opts *common.GeneralOptions) *cobra.Command {
+	inspectOptions := &inspectOptions{
+		general: opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "inspect <serializer.so>...",
+		Short: "Show which schema serializers were generated from",
+		Long:  "Read the schema checksum and message name embedded in serializer libraries generated by serde, optionally comparing them against a compiled proto package.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runInspect(cmd, args, inspectOptions)
+		},
+		SilenceUsage: true,
+	}
+	addInspectToFlags(cmd.Flags(), inspectOptions)
+	return cmd
+}
+
+func runInspect(cmd *cobra.Command, args []string, opts *inspectOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.parse(args),
+	); err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+
+	reports := make([]*inspectReport, 0, len(opts.serializers))
+	mismatches := 0
+	for _, so := range opts.serializers {
+		info, err := stream.Inspect(so)
+		if err != nil {
+			return fmt.Errorf("%s: %w", so, err)
+		}
+
+		report := &inspectReport{Checksum: info.Checksum, MessageName: info.MessageName, Serializer: so}
+		if len(opts.pbChecksum) > 0 {
+			matches := info.Checksum == opts.pbChecksum
+			report.Matches = &matches
+			if !matches {
+				mismatches++
+			}
+		}
+		reports = append(reports, report)
+
+		if opts.format != formatText {
+			continue
+		}
+		fmt.Fprintf(out, "%s: %s: checksum %s", filepath.Base(so), info.MessageName, info.Checksum)
+		switch {
+		case report.Matches == nil:
+			fmt.Fprintln(out)
+		case *report.Matches:
+			fmt.Fprintf(out, ": matches %s\n", opts.pbPath)
+		default:
+			fmt.Fprintf(out, ": does not match %s (checksum %s)\n", opts.pbPath, opts.pbChecksum)
+		}
+	}
+
+	if opts.format == formatJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d serializer(s) were not generated from %s", mismatches, opts.pbPath)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package serde
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"jbpf_protobuf_cli/generator/schema"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type lintOptions struct {
+	general *common.GeneralOptions
+
+	absWorkingDir  string
+	compiler       *nanopb.CompilerOptions
+	format         string
+	nestedMessages bool
+	protoConfigs   []string
+	schemas        []*parsedProtoConfig
+	workingDir     string
+}
+
+type lintPackageReport struct {
+	Messages []*schema.MessageReport
+	Package  string
+}
+
+func addLintToFlags(flags *pflag.FlagSet, opts *lintOptions) {
+	flags.BoolVar(&opts.nestedMessages, "nested-messages", false, "include nested messages when no message names are listed")
+	flags.StringArrayVarP(&opts.protoConfigs, "schema", "s", []string{}, `proto file(s) to lint, along with any message names. In the form "{proto package name}:{proto message names,}". Defaults to all proto files in the working directory`)
+	flags.StringVar(&opts.format, "format", formatText, "output format, set to text or json")
+	flags.StringVarP(&opts.workingDir, "workdir", "w", relativeWorkingDir, "working directory, will default to the current directory")
+	nanopb.AddTargetOptionsToFlags(flags, opts.compiler)
+}
+
+func (o *lintOptions) parse() error {
+	var err error
+	o.absWorkingDir, err = filepath.Abs(o.workingDir)
+	if err != nil {
+		return err
+	}
+	if err := validateDir(o.absWorkingDir); err != nil {
+		return err
+	}
+
+	if o.format != formatJSON && o.format != formatText {
+		return fmt.Errorf("invalid format: %s", o.format)
+	}
+
+	if len(o.protoConfigs) == 0 {
+		protoFiles, err := filepath.Glob(filepath.Join(o.absWorkingDir, "*.proto"))
+		if err != nil {
+			return err
+		}
+		for _, f := range protoFiles {
+			o.protoConfigs = append(o.protoConfigs, strings.TrimSuffix(filepath.Base(f), ".proto")+":")
+		}
+	}
+
+	o.schemas, err = parseSchemas(o.protoConfigs)
+	return err
+}
+
+func lintCommand(opts *common.GeneralOptions) *cobra.Command {
+	lintOptions := &lintOptions{
+		compiler: &nanopb.CompilerOptions{},
+		general:  opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check proto messages are jbpf compatible",
+		Long:  "Check nanopb can represent proto messages as fixed-size contiguous structs, as required by jbpf. Reports each field which would be generated as a callback or pointer along with the estimated size of each struct, and fails if any issues are found. Sizes are estimated for --target, or the host when it is not set; \"serde --report\" measures them with the C compiler.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runLint(cmd, lintOptions)
+		},
+		SilenceUsage: true,
+	}
+	addLintToFlags(cmd.Flags(), lintOptions)
+	return cmd
+}
+
+func runLint(cmd *cobra.Command, opts *lintOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.compiler.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	logger := opts.general.Logger
+	out := cmd.OutOrStdout()
+
+	fileCfgs, err := nanopb.FindFiles(logger, opts.absWorkingDir)
+	if err != nil {
+		return err
+	}
+
+	packageReports := make([]*lintPackageReport, 0, len(opts.schemas))
+	issues := 0
+	for _, cfg := range opts.schemas {
+		reports, err := schema.Lint(cmd.Context(), logger, &schema.Config{
+			CompilerOptions:   opts.compiler,
+			Files:             fileCfgs,
+			NestedMessages:    opts.nestedMessages,
+			ProtoMessageNames: cfg.protoMessageNames,
+			ProtoPackageName:  cfg.protoPackageName,
+		})
+		if err != nil {
+			return err
+		}
+		packageReports = append(packageReports, &lintPackageReport{Messages: reports, Package: cfg.protoPackageName})
+
+		for _, report := range reports {
+			issues += len(report.Issues)
+			if opts.format != formatText {
+				continue
+			}
+			for _, issue := range report.Issues {
+				if strings.HasPrefix(string(issue.Name), string(report.Name)+".") || issue.Name == report.Name {
+					fmt.Fprintf(out, "%s.proto: error: %s\n", cfg.protoPackageName, issue)
+				} else {
+					fmt.Fprintf(out, "%s.proto: error: %s (used by %s)\n", cfg.protoPackageName, issue, report.Name)
+				}
+			}
+			if report.Layout != nil {
+				fmt.Fprintf(out, "%s.proto: ok: %s: sizeof(%s) = %d\n", cfg.protoPackageName, report.Name, report.CTypeName, report.Layout.Size)
+			}
+		}
+	}
+
+	if opts.format == formatJSON {
+		data, err := json.MarshalIndent(packageReports, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	}
+
+	if issues > 0 {
+		return fmt.Errorf("found %d issue(s) preventing messages being used with jbpf", issues)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package serde
+
+import (
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"jbpf_protobuf_cli/generator/sample"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+type sampleOptions struct {
+	general *common.GeneralOptions
+	sample  *sample.Options
+
+	md          protoreflect.MessageDescriptor
+	msgName     string
+	nanopbOpts  *nanopb.Options
+	optionsPath string
+	pbPath      string
+}
+
+func addSampleToFlags(flags *pflag.FlagSet, opts *sampleOptions) {
+	flags.StringVar(&opts.msgName, "msg", "", "full name of the message to generate a sample of")
+	flags.StringVar(&opts.optionsPath, "options", "", `nanopb .options file with the max_size and max_count of fields, will default to "{pb base name}.options" alongside --pb if it exists`)
+	flags.StringVar(&opts.pbPath, "pb", "", "compiled proto package containing the message")
+}
+
+func (o *sampleOptions) parse() error {
+	if len(o.pbPath) == 0 || len(o.msgName) == 0 {
+		return errors.New("--pb and --msg must be provided")
+	}
+
+	data, err := os.ReadFile(o.pbPath)
+	if err != nil {
+		return err
+	}
+	o.md, err = common.FindMessageDescriptor(data, o.msgName)
+	if err != nil {
+		return fmt.Errorf("message %s not found in %s: %w", o.msgName, o.pbPath, err)
+	}
+
+	if len(o.optionsPath) == 0 {
+		o.nanopbOpts, err = nanopb.LoadOptionsForProto(o.pbPath)
+		return err
+	}
+	optionsData, err := os.ReadFile(o.optionsPath)
+	if err != nil {
+		return err
+	}
+	o.nanopbOpts, err = nanopb.ParseOptions(optionsData)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", o.optionsPath, err)
+	}
+	return nil
+}
+
+func sampleCommand(opts *common.GeneralOptions) *cobra.Command {
+	sampleOptions := &sampleOptions{
+		general: opts,
+		sample:  &sample.Options{},
+	}
+	cmd := &cobra.Command{
+		Use:   "sample",
+		Short: "Generate a sample JSON message",
+		Long:  "Generate a JSON document for a message, which can be used as the payload of `input forward` or as a sample for `serde verify`. By default the document is a skeleton with every field set to its zero value. With --random the fields are filled with random values which still fit in the struct nanopb generates, suitable for fuzzing.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runSample(cmd, sampleOptions)
+		},
+		SilenceUsage: true,
+	}
+	addSampleToFlags(cmd.Flags(), sampleOptions)
+	sample.AddOptionsToFlags(cmd.Flags(), sampleOptions.sample)
+	return cmd
+}
+
+func runSample(cmd *cobra.Command, opts *sampleOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.sample.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	if opts.sample.Random() {
+		opts.general.Logger.WithField("seed", opts.sample.Seed()).Debug("generating random sample")
+	}
+
+	data, err := sample.Marshal(sample.Generate(opts.sample, opts.nanopbOpts, opts.md))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	return err
+}
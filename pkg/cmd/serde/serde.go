@@ -4,18 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/golang"
 	"jbpf_protobuf_cli/generator/nanopb"
 	"jbpf_protobuf_cli/generator/schema"
+	"jbpf_protobuf_cli/generator/stream"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 const (
+	defaultHostCC      = "cc"
+	formatJSON         = "json"
+	formatText         = "text"
 	relativeWorkingDir = "./"
 )
 
@@ -29,14 +35,21 @@ type parsedProtoConfig struct {
 }
 
 type runOptions struct {
-	general *common.GeneralOptions
-
-	absOutputDir  string
-	absWorkingDir string
-	outputDir     string
-	protoConfigs  []string
-	schemas       []*parsedProtoConfig
-	workingDir    string
+	compiler *nanopb.CompilerOptions
+	general  *common.GeneralOptions
+	golang   *golang.Options
+
+	absOutputDir   string
+	absWorkingDir  string
+	allMessages    bool
+	nestedMessages bool
+	outputDir      string
+	protoConfigs   []string
+	report         bool
+	schemas        []*parsedProtoConfig
+	template       *template.Template
+	templatePath   string
+	workingDir     string
 }
 
 func init() {
@@ -48,8 +61,12 @@ func init() {
 }
 
 func addToFlags(flags *pflag.FlagSet, opts *runOptions) {
+	flags.BoolVar(&opts.allMessages, "all-messages", false, "generate serializers for every message of a schema which has no message names listed, skipping messages which cannot be represented as fixed-size structs")
+	flags.BoolVar(&opts.nestedMessages, "nested-messages", false, "include nested messages when using --all-messages")
+	flags.BoolVar(&opts.report, "report", false, `write "{proto package name}.report.json" listing the C struct size, max encoded size and field layout of each requested message and the messages it depends on, or of every message if none are requested, as measured by compiling a probe against the generated header`)
 	flags.StringArrayVarP(&opts.protoConfigs, "schema", "s", []string{}, `source proto file(s), along with any message names. In the form "{proto package name}:{proto message names,}"`)
 	flags.StringVarP(&opts.outputDir, "output-dir", "o", relativeWorkingDir, "output directory, will default to the current directory")
+	flags.StringVar(&opts.templatePath, "template", "", "custom Go text/template file used to render each serializer instead of the default. The rendered C must export jbpf_io_serialize and jbpf_io_deserialize")
 	flags.StringVarP(&opts.workingDir, "workdir", "w", relativeWorkingDir, "working directory, will default to the current directory")
 }
 
@@ -76,15 +93,29 @@ func (o *runOptions) parse() error {
 		return err
 	}
 
-	o.schemas = make([]*parsedProtoConfig, len(o.protoConfigs))
-	for i, s := range o.protoConfigs {
+	if len(o.templatePath) > 0 {
+		var err error
+		o.template, err = stream.LoadTemplate(o.templatePath)
+		if err != nil {
+			return fmt.Errorf("failed to load serializer template: %w", err)
+		}
+	}
+
+	var err error
+	o.schemas, err = parseSchemas(o.protoConfigs)
+	return err
+}
+
+func parseSchemas(protoConfigs []string) ([]*parsedProtoConfig, error) {
+	schemas := make([]*parsedProtoConfig, len(protoConfigs))
+	for i, s := range protoConfigs {
 		parts := strings.Split(s, ":")
 		if len(parts) != 2 {
-			return errors.New("invalid schema format")
+			return nil, errors.New("invalid schema format")
 		}
 		protoPackageName := strings.TrimSpace(parts[0])
 		if len(protoPackageName) == 0 {
-			return errors.New("invalid schema format")
+			return nil, errors.New("invalid schema format")
 		}
 		protoMessageNames := make([]string, 0)
 		if len(parts[1]) > 0 {
@@ -92,24 +123,26 @@ func (o *runOptions) parse() error {
 			for i := range protoMessageNames {
 				protoMessageNames[i] = strings.TrimSpace(protoMessageNames[i])
 				if len(protoMessageNames[i]) == 0 {
-					return errors.New("invalid schema format")
+					return nil, errors.New("invalid schema format")
 				}
 			}
 		}
 
-		o.schemas[i] = &parsedProtoConfig{
+		schemas[i] = &parsedProtoConfig{
 			protoPackageName:  protoPackageName,
 			protoMessageNames: protoMessageNames,
 		}
 	}
 
-	return nil
+	return schemas, nil
 }
 
 // Command Generate serde assets for protobuf spec
 func Command(opts *common.GeneralOptions) *cobra.Command {
 	runOptions := &runOptions{
-		general: opts,
+		compiler: &nanopb.CompilerOptions{},
+		general:  opts,
+		golang:   &golang.Options{},
 	}
 	cmd := &cobra.Command{
 		Use:   "serde",
@@ -119,13 +152,24 @@ func Command(opts *common.GeneralOptions) *cobra.Command {
 		},
 		SilenceUsage: true,
 	}
-	addToFlags(cmd.PersistentFlags(), runOptions)
+	addToFlags(cmd.Flags(), runOptions)
+	nanopb.AddCompilerOptionsToFlags(cmd.Flags(), runOptions.compiler)
+	golang.AddOptionsToFlags(cmd.Flags(), runOptions.golang)
+	cmd.AddCommand(
+		diffCommand(opts),
+		inspectCommand(opts),
+		lintCommand(opts),
+		sampleCommand(opts),
+		verifyCommand(opts),
+	)
 	return cmd
 }
 
 func run(cmd *cobra.Command, opts *runOptions) error {
 	if err := errors.Join(
 		opts.general.Parse(),
+		opts.compiler.Parse(),
+		opts.golang.Parse(),
 		opts.parse(),
 	); err != nil {
 		return err
@@ -140,9 +184,14 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 		}
 
 		files, err := schema.Generate(cmd.Context(), logger, &schema.Config{
-			Files:             fileCfgs,
-			ProtoPackageName:  cfg.protoPackageName,
-			ProtoMessageNames: cfg.protoMessageNames,
+			AllMessages:        opts.allMessages,
+			CompilerOptions:    opts.compiler,
+			Files:              fileCfgs,
+			NestedMessages:     opts.nestedMessages,
+			ProtoPackageName:   cfg.protoPackageName,
+			ProtoMessageNames:  cfg.protoMessageNames,
+			Report:             opts.report,
+			SerializerTemplate: opts.template,
 		})
 		if err != nil {
 			return err
@@ -151,7 +200,28 @@ func run(cmd *cobra.Command, opts *runOptions) error {
 		if err := common.WriteFilesToDirectory(logger, opts.absOutputDir, files); err != nil {
 			return err
 		}
+
+		if opts.golang.Enabled() {
+			if err := generateGo(cmd, opts, cfg.protoPackageName, files); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
+
+func generateGo(cmd *cobra.Command, opts *runOptions, protoPackageName string, files []*common.File) error {
+	pbFile := protoPackageName + ".pb"
+	for _, f := range files {
+		if f.Name != pbFile {
+			continue
+		}
+		goFiles, err := golang.Generate(cmd.Context(), opts.general.Logger, opts.golang, protoPackageName, f.Data)
+		if err != nil {
+			return err
+		}
+		return common.WriteFilesToDirectory(opts.general.Logger, opts.golang.OutputDir(), goFiles)
+	}
+	return fmt.Errorf("%s was not generated", pbFile)
+}
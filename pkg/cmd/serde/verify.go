@@ -0,0 +1,150 @@
+package serde
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/stream"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type verifyOptions struct {
+	general *common.GeneralOptions
+
+	cc             string
+	maxEncodedSize int
+	md             protoreflect.MessageDescriptor
+	msgName        string
+	pbChecksum     string
+	pbPath         string
+	samples        []string
+	soInfo         *stream.SerializerInfo
+	soPath         string
+}
+
+func addVerifyToFlags(flags *pflag.FlagSet, opts *verifyOptions) {
+	flags.IntVar(&opts.maxEncodedSize, "max-encoded-size", 1<<20, "size of the buffer passed to jbpf_io_serialize")
+	flags.StringArrayVar(&opts.samples, "json", []string{}, "sample message(s) in JSON format to round trip")
+	flags.StringVar(&opts.cc, "cc", defaultHostCC, "host C compiler used to build the round trip helper")
+	flags.StringVar(&opts.msgName, "msg", "", "full name of the message, will default to the message name embedded in the serializer")
+	flags.StringVar(&opts.pbPath, "pb", "", "compiled proto package the serializer was generated from")
+	flags.StringVar(&opts.soPath, "so", "", "serializer library to verify")
+}
+
+func (o *verifyOptions) parse() error {
+	if len(o.soPath) == 0 || len(o.pbPath) == 0 {
+		return errors.New("--so and --pb must be provided")
+	}
+	if len(o.samples) == 0 {
+		return errors.New("at least one --json sample must be provided")
+	}
+
+	data, err := os.ReadFile(o.pbPath)
+	if err != nil {
+		return err
+	}
+	o.pbChecksum = fmt.Sprintf("%x", sha1.Sum(data))
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return err
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return err
+	}
+
+	// serializers generated by older versions or custom templates may not have an embedded fingerprint
+	o.soInfo, err = stream.Inspect(o.soPath)
+	if errors.Is(err, stream.ErrNoFingerprint) {
+		o.soInfo = nil
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", o.soPath, err)
+	}
+
+	msgName := o.msgName
+	if len(msgName) == 0 {
+		if o.soInfo == nil {
+			return fmt.Errorf("%s has no embedded message name, --msg must be provided", o.soPath)
+		}
+		msgName = o.soInfo.MessageName
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(msgName))
+	if err != nil {
+		return fmt.Errorf("message %s not found in %s: %w", msgName, o.pbPath, err)
+	}
+	var ok bool
+	if o.md, ok = desc.(protoreflect.MessageDescriptor); !ok {
+		return fmt.Errorf("%s is not a message, got %T", msgName, desc)
+	}
+
+	return nil
+}
+
+func verifyCommand(opts *common.GeneralOptions) *cobra.Command {
+	verifyOptions := &verifyOptions{
+		general: opts,
+	}
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify messages round trip through a serializer",
+		Long:  "Encode JSON sample messages with Go protobuf, decode them into a struct with the serializer's jbpf_io_deserialize, encode the struct with jbpf_io_serialize, and check the result decodes to an equal message. Catches max_size truncation and struct size mismatches before deployment. The serializer must be built for the host.",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runVerify(cmd, verifyOptions)
+		},
+		SilenceUsage: true,
+	}
+	addVerifyToFlags(cmd.Flags(), verifyOptions)
+	return cmd
+}
+
+func runVerify(cmd *cobra.Command, opts *verifyOptions) error {
+	if err := errors.Join(
+		opts.general.Parse(),
+		opts.parse(),
+	); err != nil {
+		return err
+	}
+
+	logger := opts.general.Logger
+	out := cmd.OutOrStdout()
+
+	if opts.soInfo != nil && opts.soInfo.Checksum != opts.pbChecksum {
+		logger.WithField("serializer", opts.soPath).Warnf("serializer was not generated from %s", opts.pbPath)
+	}
+
+	roundTripper, err := stream.NewRoundTripper(cmd.Context(), logger, opts.cc)
+	if err != nil {
+		return err
+	}
+	defer roundTripper.Close()
+	roundTripper.MaxEncodedSize = opts.maxEncodedSize
+
+	failures := 0
+	for _, sample := range opts.samples {
+		jsonData, err := os.ReadFile(sample)
+		if err != nil {
+			return err
+		}
+		if err := roundTripper.Verify(cmd.Context(), opts.soPath, opts.md, jsonData); err != nil {
+			failures++
+			fmt.Fprintf(out, "%s: error: %s\n", filepath.Base(sample), err)
+			continue
+		}
+		fmt.Fprintf(out, "%s: ok: %s\n", filepath.Base(sample), opts.md.FullName())
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d sample(s) did not round trip through %s", failures, len(opts.samples), opts.soPath)
+	}
+	return nil
+}
@@ -1,19 +1,28 @@
 package common
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"jbpf_protobuf_cli/compiler"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	compiledProtoExt      = ".pb"
+	compiledProtoFileMode = fs.FileMode(0644)
+	protoSourceExt        = ".proto"
 )
 
 // ProtobufConfig represents the configuration for a protobuf message
 type ProtobufConfig struct {
 	MsgName     string
-	PackageName string
 	PackagePath string
 }
 
@@ -25,48 +34,54 @@ func newProtobufConfig(cfg *ProtobufRawConfig) (*ProtobufConfig, error) {
 		return nil, fmt.Errorf("missing required field serde.protobuf.package_path")
 	}
 
-	packagePath := os.ExpandEnv(cfg.PackagePath)
-	basename := filepath.Base(packagePath)
-
 	return &ProtobufConfig{
 		MsgName:     cfg.MsgName,
-		PackageName: strings.TrimSuffix(basename, filepath.Ext(basename)),
-		PackagePath: packagePath,
+		PackagePath: cfg.PackagePath,
 	}, nil
 }
 
 // SerdeConfig represents the configuration for serialize/deserialize
 type SerdeConfig struct {
+	FilePath string
+	// Protobuf is nil when the io channel has no protobuf schema
 	Protobuf *ProtobufConfig
 }
 
 func newSerdeConfig(cfg *SerdeRawConfig) (*SerdeConfig, error) {
+	serde := &SerdeConfig{FilePath: cfg.FilePath}
 	if cfg.Protobuf == nil {
-		return nil, fmt.Errorf("missing required field serde.protobuf")
+		return serde, nil
 	}
 
 	protobuf, err := newProtobufConfig(cfg.Protobuf)
 	if err != nil {
 		return nil, err
 	}
+	serde.Protobuf = protobuf
 
-	return &SerdeConfig{Protobuf: protobuf}, nil
+	return serde, nil
 }
 
 // IOChannelConfig represents the configuration for an IO channel
 type IOChannelConfig struct {
+	Name string
+	// Serde is nil when the io channel has no serde
 	Serde      *SerdeConfig
 	StreamUUID uuid.UUID
 }
 
-func newIOChannelConfig(cfg *IOChannelRawConfig) (*IOChannelConfig, error) {
-	if cfg.Serde == nil {
-		return nil, fmt.Errorf("missing required field serde")
-	}
+// HasProtobuf returns true if the io channel has a protobuf schema
+func (c *IOChannelConfig) HasProtobuf() bool {
+	return c.Serde != nil && c.Serde.Protobuf != nil
+}
 
-	serde, err := newSerdeConfig(cfg.Serde)
-	if err != nil {
-		return nil, err
+func newIOChannelConfig(cfg *IOChannelRawConfig) (*IOChannelConfig, error) {
+	var serde *SerdeConfig
+	if cfg.Serde != nil {
+		var err error
+		if serde, err = newSerdeConfig(cfg.Serde); err != nil {
+			return nil, err
+		}
 	}
 
 	streamUUID, err := uuid.Parse(cfg.StreamID)
@@ -75,15 +90,49 @@ func newIOChannelConfig(cfg *IOChannelRawConfig) (*IOChannelConfig, error) {
 	}
 
 	return &IOChannelConfig{
+		Name:       cfg.Name,
 		Serde:      serde,
 		StreamUUID: streamUUID,
 	}, nil
 }
 
+// LinkedMapConfig represents a map shared with another codelet of the codeletset
+type LinkedMapConfig struct {
+	LinkedCodeletName string
+	LinkedMapName     string
+	MapName           string
+}
+
+func newLinkedMapConfig(cfg *LinkedMapRawConfig) (*LinkedMapConfig, error) {
+	if len(cfg.MapName) == 0 {
+		return nil, fmt.Errorf("missing required field linked_maps.map_name")
+	}
+	if len(cfg.LinkedCodeletName) == 0 {
+		return nil, fmt.Errorf("missing required field linked_maps.linked_codelet_name")
+	}
+	if len(cfg.LinkedMapName) == 0 {
+		return nil, fmt.Errorf("missing required field linked_maps.linked_map_name")
+	}
+
+	return &LinkedMapConfig{
+		LinkedCodeletName: cfg.LinkedCodeletName,
+		LinkedMapName:     cfg.LinkedMapName,
+		MapName:           cfg.MapName,
+	}, nil
+}
+
 // CodeletDescriptorConfig represents the configuration for a codelet descriptor
 type CodeletDescriptorConfig struct {
+	CodeletName  string
+	CodeletPath  string
+	HookName     string
 	InIOChannel  []*IOChannelConfig
+	LinkedMaps   []*LinkedMapConfig
 	OutIOChannel []*IOChannelConfig
+	// Priority is nil when jbpf's default priority applies
+	Priority *uint32
+	// RuntimeThreshold is nil when jbpf's default runtime threshold applies
+	RuntimeThreshold *uint64
 }
 
 func newCodeletDescriptorConfig(cfg *CodeletDescriptorRawConfig) (*CodeletDescriptorConfig, error) {
@@ -105,15 +154,33 @@ func newCodeletDescriptorConfig(cfg *CodeletDescriptorRawConfig) (*CodeletDescri
 		outIOChannel = append(outIOChannel, io)
 	}
 
+	linkedMaps := make([]*LinkedMapConfig, 0, len(cfg.LinkedMaps))
+	for _, rawMap := range cfg.LinkedMaps {
+		linkedMap, err := newLinkedMapConfig(rawMap)
+		if err != nil {
+			return nil, err
+		}
+		linkedMaps = append(linkedMaps, linkedMap)
+	}
+
 	return &CodeletDescriptorConfig{
-		InIOChannel:  inIOChannel,
-		OutIOChannel: outIOChannel,
+		CodeletName:      cfg.CodeletName,
+		CodeletPath:      cfg.CodeletPath,
+		HookName:         cfg.HookName,
+		InIOChannel:      inIOChannel,
+		LinkedMaps:       linkedMaps,
+		OutIOChannel:     outIOChannel,
+		Priority:         cfg.Priority,
+		RuntimeThreshold: cfg.RuntimeThreshold,
 	}, nil
 }
 
-// CodeletsetConfig represents the configuration for loading a decoder
+// CodeletsetConfig represents a jbpf codeletset load or unload request. An unload request only has a CodeletsetID.
 type CodeletsetConfig struct {
 	CodeletDescriptor []*CodeletDescriptorConfig
+	CodeletsetID      string
+	// Path is the file the config was read from, or StdinConfigPath
+	Path string
 }
 
 func newCodeletSetConfig(cfg *CodeletsetRawConfig) (*CodeletsetConfig, error) {
@@ -125,64 +192,118 @@ func newCodeletSetConfig(cfg *CodeletsetRawConfig) (*CodeletsetConfig, error) {
 		}
 		codeletDescriptors = append(codeletDescriptors, desc)
 	}
-	return &CodeletsetConfig{CodeletDescriptor: codeletDescriptors}, nil
+	return &CodeletsetConfig{
+		CodeletDescriptor: codeletDescriptors,
+		CodeletsetID:      cfg.CodeletsetID,
+	}, nil
+}
+
+// loadCompiledProto loads a compiled protobuf file, compiling it first along with its imports if it is a .proto source
+func loadCompiledProto(packagePath string, importPaths []string) (*File, error) {
+	if filepath.Ext(packagePath) != protoSourceExt {
+		return NewFile(packagePath)
+	}
+
+	fds, err := compiler.Compile(
+		context.Background(),
+		[]string{filepath.Base(packagePath)},
+		append([]string{filepath.Dir(packagePath)}, importPaths...),
+		true,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s: %w", packagePath, err)
+	}
+
+	data, err := proto.Marshal(fds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		Data: data,
+		Mode: compiledProtoFileMode,
+		Name: strings.TrimSuffix(filepath.Base(packagePath), protoSourceExt) + compiledProtoExt,
+	}, nil
 }
 
-// LoadCompiledProtos loads the compiled protobuf files from the codeletset config
-func LoadCompiledProtos(cfgs []*CodeletsetConfig, includeInIO, includeOutIO bool) (map[string]*File, error) {
+// LoadCompiledProtos loads the compiled protobuf files from the codeletset config. A package_path may be a compiled
+// .pb file, or a .proto source which is compiled along with its imports. Imports are resolved relative to the
+// directory of the .proto source, then the import paths. The msg_name of every io channel must be defined in its
+// package, otherwise an error suggesting close matches is returned for each.
+func LoadCompiledProtos(cfgs []*CodeletsetConfig, importPaths []string, includeInIO, includeOutIO bool) (map[string]*File, error) {
 	compiledProtos := make(map[string]*File)
+	files := make(map[string]*protoregistry.Files)
+	msgErrs := make([]error, 0)
+
+	load := func(ios []*IOChannelConfig) error {
+		for _, io := range ios {
+			if !io.HasProtobuf() {
+				continue
+			}
+			protobuf := io.Serde.Protobuf
+			if _, ok := compiledProtos[protobuf.PackagePath]; !ok {
+				protoPkg, err := loadCompiledProto(protobuf.PackagePath, importPaths)
+				if err != nil {
+					return err
+				}
+				pkgFiles, err := NewFilesFromCompiledProto(protoPkg.Data)
+				if err != nil {
+					return fmt.Errorf("failed to interpret %s: %w", protobuf.PackagePath, err)
+				}
+				compiledProtos[protobuf.PackagePath] = protoPkg
+				files[protobuf.PackagePath] = pkgFiles
+			}
+			if _, err := findMessageInFiles(files[protobuf.PackagePath], protobuf.MsgName); err != nil {
+				msgErrs = append(msgErrs, fmt.Errorf("stream %s: %w", io.StreamUUID, messageNotFoundError(files[protobuf.PackagePath], protobuf.MsgName, protobuf.PackagePath)))
+			}
+		}
+		return nil
+	}
 
 	for _, c := range cfgs {
 		for _, desc := range c.CodeletDescriptor {
 			if includeInIO {
-				for _, io := range desc.InIOChannel {
-					if _, ok := compiledProtos[io.Serde.Protobuf.PackagePath]; !ok {
-						protoPkg, err := NewFile(io.Serde.Protobuf.PackagePath)
-						if err != nil {
-							return nil, err
-						}
-						compiledProtos[io.Serde.Protobuf.PackagePath] = protoPkg
-					}
+				if err := load(desc.InIOChannel); err != nil {
+					return nil, err
 				}
 			}
 
 			if includeOutIO {
-				for _, io := range desc.OutIOChannel {
-					if _, ok := compiledProtos[io.Serde.Protobuf.PackagePath]; !ok {
-						protoPkg, err := NewFile(io.Serde.Protobuf.PackagePath)
-						if err != nil {
-							return nil, err
-						}
-						compiledProtos[io.Serde.Protobuf.PackagePath] = protoPkg
-					}
+				if err := load(desc.OutIOChannel); err != nil {
+					return nil, err
 				}
 			}
 		}
 	}
 
+	if err := errors.Join(msgErrs...); err != nil {
+		return nil, err
+	}
 	return compiledProtos, nil
 }
 
-// CodeletsetConfigFromFiles reads and unmarshals the given files into a slice of CodeletsetConfig
-func CodeletsetConfigFromFiles(configs ...string) ([]*CodeletsetConfig, error) {
-	out := make([]*CodeletsetConfig, 0, len(configs))
-	errs := make([]error, 0, len(configs))
-
-	for _, c := range configs {
-		rawConfig, err := newCodeletsetRawConfig(c)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
+// CodeletsetConfigFromFiles reads and unmarshals the given files into a slice of CodeletsetConfig, see
+// CodeletsetRawConfigFromFiles. A stream may appear in several configs as long as it is mapped to the same message.
+func CodeletsetConfigFromFiles(vars *ConfigVariables, configs ...string) ([]*CodeletsetConfig, error) {
+	paths, rawConfigs, err := readRawConfigs(vars, configs)
+	if err != nil {
+		return nil, err
+	}
 
+	out := make([]*CodeletsetConfig, 0, len(rawConfigs))
+	errs := make([]error, 0, len(rawConfigs))
+	for i, rawConfig := range rawConfigs {
 		config, err := newCodeletSetConfig(rawConfig)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to unpack file %s: %w", c, err))
+			errs = append(errs, fmt.Errorf("failed to unpack file %s: %w", ConfigDisplayName(paths[i]), err))
 			continue
 		}
-
+		config.Path = paths[i]
 		out = append(out, config)
 	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 
-	return out, errors.Join(errs...)
+	return out, checkStreamConflicts(out)
 }
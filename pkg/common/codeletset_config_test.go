@@ -0,0 +1,66 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const examplesDir = "../../examples"
+
+func TestCodeletsetConfigFromExamples(t *testing.T) {
+	t.Setenv("JBPFP_PATH", "/jbpfp")
+
+	for _, example := range []string{"first_example_ipc", "first_example_standalone"} {
+		t.Run(example, func(t *testing.T) {
+			configs, err := CodeletsetConfigFromFiles(nil, filepath.Join(examplesDir, example, "codeletset_load_request.yaml"))
+			require.NoError(t, err)
+			require.Len(t, configs, 1)
+			cfg := configs[0]
+			assert.Equal(t, "example_codeletset", cfg.CodeletsetID)
+			require.Len(t, cfg.CodeletDescriptor, 1)
+
+			desc := cfg.CodeletDescriptor[0]
+			assert.Equal(t, "example_codelet", desc.CodeletName)
+			assert.Equal(t, "/jbpfp/examples/"+example+"/example_codelet.o", desc.CodeletPath)
+			assert.Equal(t, "example", desc.HookName)
+			require.Len(t, desc.OutIOChannel, 1)
+			assert.Equal(t, "/jbpfp/examples/"+example+"/schema:packet_serializer.so", desc.OutIOChannel[0].Serde.FilePath)
+
+			configs, err = CodeletsetConfigFromFiles(nil, filepath.Join(examplesDir, example, "codeletset_unload_request.yaml"))
+			require.NoError(t, err)
+			assert.Equal(t, "example_codeletset", configs[0].CodeletsetID)
+			assert.Empty(t, configs[0].CodeletDescriptor)
+		})
+	}
+}
+
+func TestCodeletsetConfigFromFiles(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"unknown field", "codeletset_id: a\ncodelet_descriptor:\n  - codelet_name: c\n    hook: h\n", "field hook not found"},
+		{"linked maps", "codelet_descriptor:\n  - codelet_name: c\n    priority: 2\n    runtime_threshold: 1000\n    linked_maps:\n      - map_name: m\n        linked_codelet_name: d\n        linked_map_name: n\n", ""},
+		{"incomplete linked map", "codelet_descriptor:\n  - linked_maps:\n      - map_name: m\n", "missing required field linked_maps.linked_codelet_name"},
+		{"channel without serde", "codelet_descriptor:\n  - out_io_channel:\n      - name: raw\n        stream_id: 00112233445566778899aabbccddeeff\n", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0644))
+			_, err := CodeletsetConfigFromFiles(nil, path)
+			if len(tc.err) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.err)
+			}
+		})
+	}
+}
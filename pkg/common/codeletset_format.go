@@ -0,0 +1,174 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// StdinConfigPath is the config path which reads a config from stdin
+const StdinConfigPath = "-"
+
+// ConfigFormat is the format of a codeletset config
+type ConfigFormat string
+
+const (
+	// ConfigFormatJSON is a JSON config
+	ConfigFormatJSON ConfigFormat = "json"
+	// ConfigFormatTOML is a TOML config
+	ConfigFormatTOML ConfigFormat = "toml"
+	// ConfigFormatYAML is a YAML config
+	ConfigFormatYAML ConfigFormat = "yaml"
+)
+
+// tomlStatement matches the first statement of a TOML document, a table header or a key/value pair, neither of which
+// can start a YAML mapping
+var tomlStatement = regexp.MustCompile(`^(\[\[?\s*[A-Za-z0-9_"'-]|[A-Za-z0-9_"'.-]+\s*=)`)
+
+// stdin is where a config is read from for StdinConfigPath
+var stdin io.Reader = os.Stdin
+
+// DetectConfigFormat returns the format of a config, from the extension of its path if it has a known one, otherwise
+// from its content, as is the case for stdin
+func DetectConfigFormat(path string, data []byte) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ConfigFormatJSON
+	case ".toml":
+		return ConfigFormatTOML
+	case ".yaml", ".yml":
+		return ConfigFormatYAML
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return ConfigFormatJSON
+		case tomlStatement.MatchString(line):
+			return ConfigFormatTOML
+		}
+		break
+	}
+	return ConfigFormatYAML
+}
+
+// ConfigDisplayName returns the name of a config path to use in messages and generated files
+func ConfigDisplayName(path string) string {
+	if path == StdinConfigPath {
+		return "<stdin>"
+	}
+	return path
+}
+
+// readConfig reads a config file, or stdin for StdinConfigPath
+func readConfig(path string) ([]byte, error) {
+	if path == StdinConfigPath {
+		return io.ReadAll(stdin)
+	}
+	f, err := NewFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// decodeRawConfig decodes a config in the given format, rejecting unknown fields. JSON is decoded as YAML, of which it
+// is a subset.
+func decodeRawConfig(data []byte, format ConfigFormat) (*CodeletsetRawConfig, error) {
+	var rawConfig CodeletsetRawConfig
+
+	if format == ConfigFormatTOML {
+		md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&rawConfig)
+		if err != nil {
+			return nil, err
+		}
+		// unknown fields are most likely typos, so they are rejected rather than silently ignored
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+			return nil, fmt.Errorf("unknown field(s) %s", strings.Join(keys, ", "))
+		}
+		return &rawConfig, nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// unknown fields are most likely typos, so they are rejected rather than silently ignored
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rawConfig); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &rawConfig, nil
+}
+
+// parseConfigNode parses a config into a yaml.Node, so that every format can be validated alike. A TOML config is
+// converted, losing the positions of its values.
+func parseConfigNode(data []byte, format ConfigFormat) (*yaml.Node, error) {
+	var doc yaml.Node
+	if format != ConfigFormatTOML {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		return &doc, nil
+	}
+
+	var value map[string]interface{}
+	if _, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return nil, err
+	}
+	if len(value) == 0 {
+		return &doc, nil
+	}
+	var root yaml.Node
+	if err := root.Encode(value); err != nil {
+		return nil, err
+	}
+	doc.Kind = yaml.DocumentNode
+	doc.Content = []*yaml.Node{&root}
+	return &doc, nil
+}
+
+// MarshalCodeletsetRawConfig marshals a raw config in the given format, omitting unset fields
+func MarshalCodeletsetRawConfig(cfg *CodeletsetRawConfig, format ConfigFormat) ([]byte, error) {
+	var b bytes.Buffer
+	switch format {
+	case ConfigFormatJSON:
+		encoder := json.NewEncoder(&b)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(cfg); err != nil {
+			return nil, err
+		}
+	case ConfigFormatTOML:
+		encoder := toml.NewEncoder(&b)
+		encoder.Indent = ""
+		if err := encoder.Encode(cfg); err != nil {
+			return nil, err
+		}
+	case ConfigFormatYAML:
+		encoder := yaml.NewEncoder(&b)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %s, expected yaml, json or toml", format)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	formatYAML = `codeletset_id: set
+codelet_descriptor:
+  - codelet_name: c
+    priority: 2
+    out_io_channel:
+      - name: out
+        stream_id: 00112233445566778899aabbccddeeff
+`
+	formatJSON = `{
+	"codeletset_id": "set",
+	"codelet_descriptor": [
+		{"codelet_name": "c", "priority": 2, "out_io_channel": [{"name": "out", "stream_id": "00112233445566778899aabbccddeeff"}]}
+	]
+}
+`
+	formatTOML = `# a codeletset
+codeletset_id = "set"
+
+[[codelet_descriptor]]
+codelet_name = "c"
+priority = 2
+
+[[codelet_descriptor.out_io_channel]]
+name = "out"
+stream_id = "00112233445566778899aabbccddeeff"
+`
+)
+
+func TestDetectConfigFormat(t *testing.T) {
+	assert.Equal(t, ConfigFormatJSON, DetectConfigFormat("a.json", []byte(formatYAML)))
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat("a.TOML", nil))
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat("a.yml", nil))
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat(StdinConfigPath, []byte(formatYAML)))
+	assert.Equal(t, ConfigFormatJSON, DetectConfigFormat(StdinConfigPath, []byte(formatJSON)))
+	assert.Equal(t, ConfigFormatTOML, DetectConfigFormat(StdinConfigPath, []byte(formatTOML)))
+	assert.Equal(t, ConfigFormatYAML, DetectConfigFormat(StdinConfigPath, nil))
+}
+
+func TestCodeletsetConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	expected := &CodeletsetConfig{}
+	for i, tc := range []struct{ name, config string }{
+		{"config.yaml", formatYAML},
+		{"config.json", formatJSON},
+		{"config.toml", formatTOML},
+		{"config", formatTOML},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0644))
+			configs, err := CodeletsetConfigFromFiles(nil, path)
+			require.NoError(t, err)
+			if i == 0 {
+				expected = configs[0]
+				require.Len(t, expected.CodeletDescriptor, 1)
+				return
+			}
+			assert.Equal(t, path, configs[0].Path)
+			assert.Equal(t, expected.CodeletsetID, configs[0].CodeletsetID)
+			assert.Equal(t, expected.CodeletDescriptor, configs[0].CodeletDescriptor)
+		})
+	}
+
+	// unknown fields are rejected in every format
+	path := filepath.Join(dir, "unknown.toml")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(formatTOML, `name = "out"`, `nme = "out"`, 1)), 0644))
+	_, err := CodeletsetConfigFromFiles(nil, path)
+	assert.ErrorContains(t, err, "unknown field(s) codelet_descriptor.out_io_channel.nme")
+}
+
+func TestCodeletsetConfigFromStdin(t *testing.T) {
+	stdin = strings.NewReader(formatJSON)
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	configs, err := CodeletsetConfigFromFiles(nil, StdinConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, "set", configs[0].CodeletsetID)
+
+	_, err = CodeletsetConfigFromFiles(nil, StdinConfigPath, StdinConfigPath)
+	assert.ErrorContains(t, err, "stdin can only be given as a config once")
+}
+
+func TestCodeletsetConfigJSONSchema(t *testing.T) {
+	data, err := CodeletsetConfigJSONSchema()
+	require.NoError(t, err)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, false, schema["additionalProperties"])
+
+	descriptor := schema["properties"].(map[string]interface{})["codelet_descriptor"].(map[string]interface{})["items"].(map[string]interface{})
+	properties := descriptor["properties"].(map[string]interface{})
+	assert.Len(t, properties, 8)
+	assert.Equal(t, float64(4294967295), properties["priority"].(map[string]interface{})["maximum"])
+
+	channel := properties["out_io_channel"].(map[string]interface{})["items"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"stream_id"}, channel["required"])
+}
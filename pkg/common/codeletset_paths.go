@@ -0,0 +1,132 @@
+package common
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// configExts are the extensions of the files read from a config directory
+var configExts = map[string]bool{
+	".json": true,
+	".toml": true,
+	".yaml": true,
+	".yml":  true,
+}
+
+// ExpandConfigPaths expands the config paths given on the command line. A directory is replaced by the YAML, JSON and
+// TOML files beneath it, in lexical order and skipping hidden files and directories, and a glob pattern by the files
+// and directories it matches. A file given more than once is only read once.
+func ExpandConfigPaths(paths []string) ([]string, error) {
+	out := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	add := func(path string) {
+		key := path
+		if abs, err := filepath.Abs(path); err == nil {
+			key = abs
+		}
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, path)
+		}
+	}
+
+	for _, path := range paths {
+		if path == StdinConfigPath {
+			out = append(out, path)
+			continue
+		}
+
+		matches := []string{path}
+		if strings.ContainsAny(path, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(path); err != nil {
+				return nil, fmt.Errorf("invalid config pattern %s: %w", path, err)
+			} else if len(matches) == 0 {
+				return nil, fmt.Errorf("no config files match %s", path)
+			}
+		}
+
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil || !fi.IsDir() {
+				// missing files are reported when they are read
+				add(match)
+				continue
+			}
+			files, err := configFilesInDir(match)
+			if err != nil {
+				return nil, err
+			}
+			if len(files) == 0 {
+				return nil, fmt.Errorf("no .yaml, .yml, .json or .toml config files found in %s", match)
+			}
+			for _, f := range files {
+				add(f)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func configFilesInDir(dir string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && configExts[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// checkStreamConflicts checks no stream is mapped to different protobuf messages by the configs. The same mapping may
+// appear more than once, for example when a directory and one of its files are both given.
+func checkStreamConflicts(configs []*CodeletsetConfig) error {
+	type mapping struct {
+		msg  string
+		path string
+	}
+	seen := make(map[uuid.UUID]*mapping)
+	errs := make([]string, 0)
+
+	for _, config := range configs {
+		for _, desc := range config.CodeletDescriptor {
+			for _, channels := range [][]*IOChannelConfig{desc.InIOChannel, desc.OutIOChannel} {
+				for _, io := range channels {
+					if !io.HasProtobuf() {
+						continue
+					}
+					msg := fmt.Sprintf("%s in %s", io.Serde.Protobuf.MsgName, filepath.Clean(io.Serde.Protobuf.PackagePath))
+					other, ok := seen[io.StreamUUID]
+					if !ok {
+						seen[io.StreamUUID] = &mapping{msg: msg, path: config.Path}
+						continue
+					}
+					if other.msg != msg {
+						errs = append(errs, fmt.Sprintf("stream %s is mapped to %s by %s and to %s by %s", io.StreamUUID, other.msg, ConfigDisplayName(other.path), msg, ConfigDisplayName(config.Path)))
+					}
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("conflicting stream associations: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
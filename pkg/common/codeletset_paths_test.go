@@ -0,0 +1,79 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestExpandConfigPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"b.yaml":          "",
+		"a/c.json":        "",
+		"a/d/e.toml":      "",
+		"a/notes.md":      "",
+		".hidden/f.yaml":  "",
+		"a/.g.yml":        "",
+		"empty/README.md": "",
+	})
+
+	paths, err := ExpandConfigPaths([]string{dir, filepath.Join(dir, "*.yaml"), StdinConfigPath})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a/c.json"),
+		filepath.Join(dir, "a/d/e.toml"),
+		filepath.Join(dir, "b.yaml"),
+		StdinConfigPath,
+	}, paths)
+
+	paths, err = ExpandConfigPaths([]string{filepath.Join(dir, "a", "*"), "missing.yaml"})
+	require.NoError(t, err)
+	// files matched by a pattern are read whatever their name, as a file given directly is
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a/.g.yml"),
+		filepath.Join(dir, "a/c.json"),
+		filepath.Join(dir, "a/d/e.toml"),
+		filepath.Join(dir, "a/notes.md"),
+		"missing.yaml",
+	}, paths)
+
+	_, err = ExpandConfigPaths([]string{filepath.Join(dir, "*.json")})
+	assert.ErrorContains(t, err, "no config files match")
+
+	_, err = ExpandConfigPaths([]string{filepath.Join(dir, "empty")})
+	assert.ErrorContains(t, err, "no .yaml, .yml, .json or .toml config files found")
+}
+
+func TestCodeletsetConfigFromFilesStreamConflicts(t *testing.T) {
+	channel := func(msgName string) string {
+		return "codelet_descriptor:\n  - out_io_channel:\n      - stream_id: 00112233445566778899aabbccddeeff\n        serde:\n          protobuf:\n            package_path: schema.pb\n            msg_name: " + msgName + "\n"
+	}
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"cell1/set.yaml": channel("example.packet"),
+		"cell2/set.yaml": channel("example.packet"),
+	})
+	configs, err := CodeletsetConfigFromFiles(nil, dir)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, filepath.Join(dir, "cell2/set.yaml"), configs[1].Path)
+
+	writeFiles(t, dir, map[string]string{"cell3/set.yaml": channel("example.other")})
+	_, err = CodeletsetConfigFromFiles(nil, dir)
+	require.Error(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), "stream 00112233-4455-6677-8899-aabbccddeeff is mapped to example.packet in schema.pb by "+filepath.Join(dir, "cell1/set.yaml")+" and to example.other in schema.pb by "+filepath.Join(dir, "cell3/set.yaml")), err.Error())
+}
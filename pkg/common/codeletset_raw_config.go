@@ -1,49 +1,106 @@
 package common
 
 import (
+	"errors"
 	"fmt"
-
-	yaml "gopkg.in/yaml.v3"
+	"reflect"
 )
 
-// ProtobufRawConfig represents the configuration for a protobuf message as defined in the yaml config
+// ProtobufRawConfig represents the configuration for a protobuf message as defined in the config
 type ProtobufRawConfig struct {
-	MsgName     string `yaml:"msg_name"`
-	PackagePath string `yaml:"package_path"`
+	MsgName     string `description:"name of the message in the proto package, including the proto package, e.g. example.packet" jsonschema:"required" json:"msg_name,omitempty" toml:"msg_name,omitempty" yaml:"msg_name,omitempty"`
+	PackagePath string `description:"path of the compiled proto package (.pb) or its .proto source" jsonschema:"required" json:"package_path,omitempty" toml:"package_path,omitempty" yaml:"package_path,omitempty"`
 }
 
-// SerdeRawConfig represents the configuration for serialize/deserialize as defined in the yaml config
+// SerdeRawConfig represents the configuration for serialize/deserialize as defined in the config
 type SerdeRawConfig struct {
-	Protobuf *ProtobufRawConfig `yaml:"protobuf"`
+	FilePath string             `description:"path of the serde library" json:"file_path,omitempty" toml:"file_path,omitempty" yaml:"file_path,omitempty"`
+	Protobuf *ProtobufRawConfig `description:"the protobuf message of the channel" json:"protobuf,omitempty" toml:"protobuf,omitempty" yaml:"protobuf,omitempty"`
 }
 
-// IOChannelRawConfig represents the configuration for an IO channel as defined in the yaml config
+// IOChannelRawConfig represents the configuration for an IO channel as defined in the config
 type IOChannelRawConfig struct {
-	Serde    *SerdeRawConfig `yaml:"serde"`
-	StreamID string          `yaml:"stream_id"`
+	Name     string          `description:"name of the channel" json:"name,omitempty" toml:"name,omitempty" yaml:"name,omitempty"`
+	Serde    *SerdeRawConfig `description:"serializer/deserializer of the channel" json:"serde,omitempty" toml:"serde,omitempty" yaml:"serde,omitempty"`
+	StreamID string          `description:"stream ID of the channel, a UUID" jsonschema:"required" json:"stream_id,omitempty" toml:"stream_id,omitempty" yaml:"stream_id,omitempty"`
+}
+
+// LinkedMapRawConfig represents a map shared with another codelet of the codeletset as defined in the config
+type LinkedMapRawConfig struct {
+	LinkedCodeletName string `description:"name of the codelet which owns the map" jsonschema:"required" json:"linked_codelet_name,omitempty" toml:"linked_codelet_name,omitempty" yaml:"linked_codelet_name,omitempty"`
+	LinkedMapName     string `description:"name of the map in the linked codelet" jsonschema:"required" json:"linked_map_name,omitempty" toml:"linked_map_name,omitempty" yaml:"linked_map_name,omitempty"`
+	MapName           string `description:"name of the map in this codelet" jsonschema:"required" json:"map_name,omitempty" toml:"map_name,omitempty" yaml:"map_name,omitempty"`
 }
 
-// CodeletDescriptorRawConfig represents the configuration for a codelet descriptor as defined in the yaml config
+// CodeletDescriptorRawConfig represents the configuration for a codelet descriptor as defined in the config
 type CodeletDescriptorRawConfig struct {
-	InIOChannel  []*IOChannelRawConfig `yaml:"in_io_channel"`
-	OutIOChannel []*IOChannelRawConfig `yaml:"out_io_channel"`
+	CodeletName      string                `description:"name of the codelet" json:"codelet_name,omitempty" toml:"codelet_name,omitempty" yaml:"codelet_name,omitempty"`
+	CodeletPath      string                `description:"path of the codelet object file" json:"codelet_path,omitempty" toml:"codelet_path,omitempty" yaml:"codelet_path,omitempty"`
+	HookName         string                `description:"name of the hook the codelet is attached to" json:"hook_name,omitempty" toml:"hook_name,omitempty" yaml:"hook_name,omitempty"`
+	InIOChannel      []*IOChannelRawConfig `description:"input channels of the codelet" json:"in_io_channel,omitempty" toml:"in_io_channel,omitempty" yaml:"in_io_channel,omitempty"`
+	LinkedMaps       []*LinkedMapRawConfig `description:"maps shared with other codelets of the codeletset" json:"linked_maps,omitempty" toml:"linked_maps,omitempty" yaml:"linked_maps,omitempty"`
+	OutIOChannel     []*IOChannelRawConfig `description:"output channels of the codelet" json:"out_io_channel,omitempty" toml:"out_io_channel,omitempty" yaml:"out_io_channel,omitempty"`
+	Priority         *uint32               `description:"priority of the codelet on its hook" json:"priority,omitempty" toml:"priority,omitempty" yaml:"priority,omitempty"`
+	RuntimeThreshold *uint64               `description:"runtime threshold of the codelet" json:"runtime_threshold,omitempty" toml:"runtime_threshold,omitempty" yaml:"runtime_threshold,omitempty"`
 }
 
-// CodeletsetRawConfig represents the configuration for loading a decoder as defined in the yaml config
+// CodeletsetRawConfig represents a jbpf codeletset load or unload request as defined in the config
 type CodeletsetRawConfig struct {
-	CodeletDescriptor []*CodeletDescriptorRawConfig `yaml:"codelet_descriptor"`
+	CodeletDescriptor []*CodeletDescriptorRawConfig `description:"codelets of the codeletset" json:"codelet_descriptor,omitempty" toml:"codelet_descriptor,omitempty" yaml:"codelet_descriptor,omitempty"`
+	CodeletsetID      string                        `description:"ID of the codeletset" json:"codeletset_id,omitempty" toml:"codeletset_id,omitempty" yaml:"codeletset_id,omitempty"`
 }
 
-func newCodeletsetRawConfig(filePath string) (*CodeletsetRawConfig, error) {
-	f, err := NewFile(filePath)
+func newCodeletsetRawConfig(filePath string, vars *ConfigVariables) (*CodeletsetRawConfig, error) {
+	data, err := readConfig(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", ConfigDisplayName(filePath), err)
+	}
+
+	rawConfig, err := decodeRawConfig(data, DetectConfigFormat(filePath, data))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return nil, fmt.Errorf("failed to unmarshal file %s: %w", ConfigDisplayName(filePath), err)
 	}
+	expandRawConfig(reflect.ValueOf(rawConfig), vars.Lookup)
+
+	return rawConfig, nil
+}
+
+// CodeletsetRawConfigFromFiles reads and unmarshals the given files, expanding variables in every string field. The
+// paths are expanded by ExpandConfigPaths. The format of each file, YAML, JSON or TOML, is detected from its extension
+// or content, and StdinConfigPath reads a config from stdin. vars may be nil, in which case only environment variables
+// are expanded.
+func CodeletsetRawConfigFromFiles(vars *ConfigVariables, configs ...string) ([]*CodeletsetRawConfig, error) {
+	_, out, err := readRawConfigs(vars, configs)
+	return out, err
+}
+
+// readRawConfigs reads the raw configs, returning them along with the path each was read from
+func readRawConfigs(vars *ConfigVariables, configs []string) ([]string, []*CodeletsetRawConfig, error) {
+	paths, err := ExpandConfigPaths(configs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := make([]*CodeletsetRawConfig, 0, len(paths))
+	errs := make([]error, 0, len(paths))
+
+	readStdin := false
+	for _, c := range paths {
+		if c == StdinConfigPath {
+			if readStdin {
+				errs = append(errs, errors.New("stdin can only be given as a config once"))
+				continue
+			}
+			readStdin = true
+		}
 
-	var rawConfig CodeletsetRawConfig
-	if err := yaml.Unmarshal(f.Data, &rawConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal file %s: %w", filePath, err)
+		rawConfig, err := newCodeletsetRawConfig(c, vars)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, rawConfig)
 	}
 
-	return &rawConfig, nil
+	return paths, out, errors.Join(errs...)
 }
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// jsonSchema is the subset of JSON Schema needed to describe a codeletset config
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	Minimum              *uint64                `json:"minimum,omitempty"`
+	Maximum              *uint64                `json:"maximum,omitempty"`
+}
+
+// CodeletsetConfigJSONSchema returns a JSON Schema of codeletset configs, generated from the raw config types so that it
+// accepts the same fields as CodeletsetConfigFromFiles. It applies to YAML and TOML configs as well as JSON.
+func CodeletsetConfigJSONSchema() ([]byte, error) {
+	schema, err := jsonSchemaOf(reflect.TypeOf(CodeletsetRawConfig{}))
+	if err != nil {
+		return nil, err
+	}
+	schema.Schema = jsonSchemaDialect
+	schema.Title = "jbpf codeletset config"
+	schema.Description = "A jbpf codeletset load or unload request. An unload request only has a codeletset_id."
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func jsonSchemaOf(t reflect.Type) (*jsonSchema, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchemaOf(t.Elem())
+	case reflect.String:
+		return &jsonSchema{Type: "string"}, nil
+	case reflect.Uint32, reflect.Uint64:
+		maximum := uint64(math.MaxUint32)
+		if t.Kind() == reflect.Uint64 {
+			maximum = math.MaxUint64
+		}
+		minimum := uint64(0)
+		return &jsonSchema{Type: "integer", Minimum: &minimum, Maximum: &maximum}, nil
+	case reflect.Slice:
+		items, err := jsonSchemaOf(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &jsonSchema{Type: "array", Items: items}, nil
+	case reflect.Struct:
+		additionalProperties := false
+		schema := &jsonSchema{
+			Type:                 "object",
+			Properties:           make(map[string]*jsonSchema),
+			AdditionalProperties: &additionalProperties,
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			property, err := jsonSchemaOf(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			property.Description = f.Tag.Get("description")
+			schema.Properties[name] = property
+			if f.Tag.Get("jsonschema") == "required" {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
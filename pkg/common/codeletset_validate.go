@@ -0,0 +1,378 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+
+// ConfigProblem is a problem found in a codeletset config, at a position in its file
+type ConfigProblem struct {
+	Column  int
+	Line    int
+	Message string
+	Path    string
+}
+
+func (p *ConfigProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.Path, p.Line, p.Column, p.Message)
+}
+
+type streamLocation struct {
+	dir  string
+	msg  string
+	node *yaml.Node
+	path string
+}
+
+type configValidator struct {
+	compiledProtos map[string]*protoregistry.Files
+	importPaths    []string
+	loadErrors     map[string]error
+	problems       []*ConfigProblem
+	streams        map[uuid.UUID]*streamLocation
+	vars           *ConfigVariables
+}
+
+// ValidateCodeletsetConfigFiles checks codeletset config files, collecting every problem along with its position rather
+// than stopping at the first. Besides the problems CodeletsetConfigFromFiles reports, it checks that referenced files
+// exist, variables are set in vars or the environment, stream IDs are unique across all files and msg_name is defined
+// in the descriptor of package_path. Imports of a .proto package_path are resolved as in LoadCompiledProtos. Problems
+// in a TOML config have no position, other than syntax errors. Directories and glob patterns must already be expanded
+// by ExpandConfigPaths.
+func ValidateCodeletsetConfigFiles(configFiles []string, importPaths []string, vars *ConfigVariables) []*ConfigProblem {
+	v := &configValidator{
+		compiledProtos: make(map[string]*protoregistry.Files),
+		importPaths:    importPaths,
+		loadErrors:     make(map[string]error),
+		problems:       make([]*ConfigProblem, 0),
+		streams:        make(map[uuid.UUID]*streamLocation),
+		vars:           vars,
+	}
+	readStdin := false
+	for _, path := range configFiles {
+		start := len(v.problems)
+		if path == StdinConfigPath {
+			if readStdin {
+				v.add(ConfigDisplayName(path), nil, "stdin can only be given as a config once")
+				continue
+			}
+			readStdin = true
+		}
+		v.file(path)
+		// report the problems of a file in the order they appear
+		fileProblems := v.problems[start:]
+		sort.SliceStable(fileProblems, func(i, j int) bool {
+			if fileProblems[i].Line != fileProblems[j].Line {
+				return fileProblems[i].Line < fileProblems[j].Line
+			}
+			return fileProblems[i].Column < fileProblems[j].Column
+		})
+	}
+	return v.problems
+}
+
+func (v *configValidator) add(path string, node *yaml.Node, format string, args ...interface{}) {
+	p := &ConfigProblem{Message: fmt.Sprintf(format, args...), Path: path}
+	if node != nil {
+		p.Line, p.Column = node.Line, node.Column
+	}
+	v.problems = append(v.problems, p)
+}
+
+func (v *configValidator) file(configPath string) {
+	path := ConfigDisplayName(configPath)
+	data, err := readConfig(configPath)
+	if err != nil {
+		v.add(path, nil, "%s", err)
+		return
+	}
+
+	doc, err := parseConfigNode(data, DetectConfigFormat(configPath, data))
+	if err != nil {
+		p := &ConfigProblem{Message: err.Error(), Path: path}
+		var tomlErr toml.ParseError
+		if errors.As(err, &tomlErr) {
+			p.Message = tomlErr.Message
+			p.Line, p.Column = tomlErr.Position.Line, tomlErr.Position.Col
+		} else if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+			p.Line, _ = strconv.Atoi(m[1])
+			p.Column = 1
+		}
+		v.problems = append(v.problems, p)
+		return
+	}
+	if len(doc.Content) == 0 {
+		return
+	}
+
+	root := v.mapping(path, doc.Content[0], "", reflect.TypeOf(CodeletsetRawConfig{}))
+	if root == nil {
+		return
+	}
+	if node, ok := root["codeletset_id"]; ok {
+		v.scalar(path, node, "codeletset_id")
+	}
+	for i, desc := range v.sequence(path, root["codelet_descriptor"], "codelet_descriptor") {
+		v.codeletDescriptor(path, desc, fmt.Sprintf("codelet_descriptor[%d]", i))
+	}
+}
+
+// mapping checks a node is a mapping with only the fields of a raw config type, and returns its values by key
+func (v *configValidator) mapping(path string, node *yaml.Node, field string, t reflect.Type) map[string]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		if len(field) == 0 {
+			v.add(path, node, "expected a mapping")
+		} else {
+			v.add(path, node, "%s: expected a mapping", field)
+		}
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		known[name] = true
+	}
+
+	values := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch {
+		case !known[key.Value]:
+			v.add(path, key, "%s: unknown field %s", strings.TrimPrefix(field+"."+key.Value, "."), key.Value)
+		case values[key.Value] != nil:
+			v.add(path, key, "%s: duplicate field %s", strings.TrimPrefix(field+"."+key.Value, "."), key.Value)
+		default:
+			values[key.Value] = value
+		}
+	}
+	return values
+}
+
+func (v *configValidator) sequence(path string, node *yaml.Node, field string) []*yaml.Node {
+	if node == nil || node.Tag == "!!null" {
+		return nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		v.add(path, node, "%s: expected a list", field)
+		return nil
+	}
+	return node.Content
+}
+
+// scalar returns the value of a string field with any variables expanded, reporting unset variables
+func (v *configValidator) scalar(path string, node *yaml.Node, field string) (string, bool) {
+	if node.Kind != yaml.ScalarNode {
+		v.add(path, node, "%s: expected a string", field)
+		return "", false
+	}
+	expanded, unset := expandVariables(node.Value, v.vars.Lookup)
+	if len(unset) > 0 {
+		v.add(path, node, "%s: variable(s) %s not set", field, strings.Join(unset, ", "))
+		return expanded, false
+	}
+	return expanded, true
+}
+
+func (v *configValidator) required(path string, parent *yaml.Node, values map[string]*yaml.Node, field, name string) (*yaml.Node, bool) {
+	node, ok := values[name]
+	if !ok || node.Tag == "!!null" {
+		v.add(path, parent, "%s: missing required field %s", field, name)
+		return nil, false
+	}
+	return node, true
+}
+
+func (v *configValidator) fileExists(path string, node *yaml.Node, field, filePath string) bool {
+	if fi, err := os.Stat(filePath); err != nil {
+		v.add(path, node, "%s: %s", field, err)
+		return false
+	} else if fi.IsDir() {
+		v.add(path, node, `%s: expected "%s" to be a file, got a directory`, field, filePath)
+		return false
+	}
+	return true
+}
+
+func (v *configValidator) codeletDescriptor(path string, node *yaml.Node, field string) {
+	values := v.mapping(path, node, field, reflect.TypeOf(CodeletDescriptorRawConfig{}))
+	if values == nil {
+		return
+	}
+
+	for _, name := range []string{"codelet_name", "hook_name"} {
+		if n, ok := values[name]; ok {
+			v.scalar(path, n, field+"."+name)
+		}
+	}
+	if n, ok := values["codelet_path"]; ok {
+		if codeletPath, ok := v.scalar(path, n, field+".codelet_path"); ok {
+			v.fileExists(path, n, field+".codelet_path", codeletPath)
+		}
+	}
+	if n, ok := values["priority"]; ok {
+		var priority uint32
+		if err := n.Decode(&priority); err != nil {
+			v.add(path, n, "%s.priority: expected an unsigned 32 bit integer", field)
+		}
+	}
+	if n, ok := values["runtime_threshold"]; ok {
+		var threshold uint64
+		if err := n.Decode(&threshold); err != nil {
+			v.add(path, n, "%s.runtime_threshold: expected an unsigned 64 bit integer", field)
+		}
+	}
+
+	for i, io := range v.sequence(path, values["in_io_channel"], field+".in_io_channel") {
+		v.ioChannel(path, io, fmt.Sprintf("%s.in_io_channel[%d]", field, i), "in")
+	}
+	for i, io := range v.sequence(path, values["out_io_channel"], field+".out_io_channel") {
+		v.ioChannel(path, io, fmt.Sprintf("%s.out_io_channel[%d]", field, i), "out")
+	}
+
+	for i, linkedMap := range v.sequence(path, values["linked_maps"], field+".linked_maps") {
+		mapField := fmt.Sprintf("%s.linked_maps[%d]", field, i)
+		mapValues := v.mapping(path, linkedMap, mapField, reflect.TypeOf(LinkedMapRawConfig{}))
+		if mapValues == nil {
+			continue
+		}
+		for _, name := range []string{"map_name", "linked_codelet_name", "linked_map_name"} {
+			if n, ok := v.required(path, linkedMap, mapValues, mapField, name); ok {
+				v.scalar(path, n, mapField+"."+name)
+			}
+		}
+	}
+}
+
+func (v *configValidator) ioChannel(path string, node *yaml.Node, field, dir string) {
+	values := v.mapping(path, node, field, reflect.TypeOf(IOChannelRawConfig{}))
+	if values == nil {
+		return
+	}
+
+	if n, ok := values["name"]; ok {
+		v.scalar(path, n, field+".name")
+	}
+
+	// the stream is checked against the other channels once its message is known
+	var msg string
+	if n, ok := v.required(path, node, values, field, "stream_id"); ok {
+		if streamID, ok := v.scalar(path, n, field+".stream_id"); ok {
+			defer func() { v.streamID(path, n, field, dir, streamID, msg) }()
+		}
+	}
+
+	serde, ok := values["serde"]
+	if !ok || serde.Tag == "!!null" {
+		return
+	}
+	serdeValues := v.mapping(path, serde, field+".serde", reflect.TypeOf(SerdeRawConfig{}))
+	if serdeValues == nil {
+		return
+	}
+	if n, ok := serdeValues["file_path"]; ok {
+		if filePath, ok := v.scalar(path, n, field+".serde.file_path"); ok {
+			v.fileExists(path, n, field+".serde.file_path", filePath)
+		}
+	}
+
+	protobuf, ok := serdeValues["protobuf"]
+	if !ok || protobuf.Tag == "!!null" {
+		return
+	}
+	protobufField := field + ".serde.protobuf"
+	protobufValues := v.mapping(path, protobuf, protobufField, reflect.TypeOf(ProtobufRawConfig{}))
+	if protobufValues == nil {
+		return
+	}
+	msgNameNode, hasMsgName := v.required(path, protobuf, protobufValues, protobufField, "msg_name")
+	var msgName string
+	if hasMsgName {
+		msgName, hasMsgName = v.scalar(path, msgNameNode, protobufField+".msg_name")
+	}
+	packagePathNode, ok := v.required(path, protobuf, protobufValues, protobufField, "package_path")
+	if !ok {
+		return
+	}
+	packagePath, ok := v.scalar(path, packagePathNode, protobufField+".package_path")
+	if ok && hasMsgName {
+		msg = fmt.Sprintf("%s in %s", msgName, filepath.Clean(packagePath))
+	}
+	if !ok || !v.fileExists(path, packagePathNode, protobufField+".package_path", packagePath) {
+		return
+	}
+
+	files, err := v.compiledProto(packagePath)
+	if err != nil {
+		v.add(path, packagePathNode, "%s.package_path: %s", protobufField, err)
+		return
+	}
+	if hasMsgName {
+		if _, err := findMessageInFiles(files, msgName); err != nil {
+			v.add(path, msgNameNode, "%s.msg_name: %s", protobufField, messageNotFoundError(files, msgName, packagePath))
+		}
+	}
+}
+
+func (v *configValidator) streamID(path string, node *yaml.Node, field, dir, streamID, msg string) {
+	streamUUID, err := uuid.Parse(streamID)
+	if err != nil {
+		v.add(path, node, "%s.stream_id: %s", field, err)
+		return
+	}
+
+	if other, ok := v.streams[streamUUID]; ok {
+		// the same channel may appear in several files, as CodeletsetConfigFromFiles allows
+		if other.path != path && other.dir == dir && len(msg) > 0 && other.msg == msg {
+			return
+		}
+		location := fmt.Sprintf("%s:%d:%d", other.path, other.node.Line, other.node.Column)
+		switch {
+		case other.dir != dir:
+			v.add(path, node, "%s.stream_id: %s is shared by an %s channel and an %s channel at %s", field, streamUUID, dir, other.dir, location)
+		case len(msg) > 0 && len(other.msg) > 0 && other.msg != msg:
+			v.add(path, node, "%s.stream_id: %s is mapped to %s, but to %s at %s", field, streamUUID, msg, other.msg, location)
+		default:
+			v.add(path, node, "%s.stream_id: %s is already used at %s", field, streamUUID, location)
+		}
+		return
+	}
+	v.streams[streamUUID] = &streamLocation{dir: dir, msg: msg, node: node, path: path}
+}
+
+// compiledProto loads and interprets a package_path once, remembering any error
+func (v *configValidator) compiledProto(packagePath string) (*protoregistry.Files, error) {
+	if files, ok := v.compiledProtos[packagePath]; ok {
+		return files, nil
+	}
+	if err, ok := v.loadErrors[packagePath]; ok {
+		return nil, err
+	}
+	f, err := loadCompiledProto(packagePath, v.importPaths)
+	if err == nil {
+		var files *protoregistry.Files
+		if files, err = NewFilesFromCompiledProto(f.Data); err == nil {
+			v.compiledProtos[packagePath] = files
+			return files, nil
+		}
+	}
+	v.loadErrors[packagePath] = err
+	return nil, err
+}
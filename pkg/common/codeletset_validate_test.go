@@ -0,0 +1,77 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snapshotDir = "../__snapshots__"
+
+func TestValidateCodeletsetConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	pbPath, err := filepath.Abs(filepath.Join(snapshotDir, "example1", "example.pb"))
+	require.NoError(t, err)
+	t.Setenv("EXAMPLE_PB", pbPath)
+
+	write := func(name, config string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(config), 0644))
+		return path
+	}
+
+	first := write("first.yaml", `codeletset_id: first
+codelet_descriptor:
+  - codelet_name: a
+    hook: example
+    in_io_channel:
+      - stream_id: 00112233445566778899aabbccddeeff
+        serde:
+          file_path: ${UNSET_VALIDATE_VAR}/a.so
+          protobuf:
+            package_path: ${EXAMPLE_PB}
+            msg_name: statuss
+    out_io_channel:
+      - stream_id: 00112233445566778899aabbccddeeff
+        serde:
+          protobuf:
+            package_path: ${EXAMPLE_PB}
+            msg_name: status
+      - stream_id: not-a-uuid
+`)
+	second := write("second.yaml", `codelet_descriptor:
+  - out_io_channel:
+      - stream_id: 00112233445566778899aabbccddeeff
+        serde:
+          protobuf:
+            package_path: missing.pb
+            msg_name: status
+`)
+
+	problems := ValidateCodeletsetConfigFiles([]string{first, second}, nil, nil)
+	messages := make([]string, len(problems))
+	for i, p := range problems {
+		messages[i] = p.String()
+	}
+	assert.Equal(t, []string{
+		first + ":4:5: codelet_descriptor[0].hook: unknown field hook",
+		first + ":8:22: codelet_descriptor[0].in_io_channel[0].serde.file_path: variable(s) UNSET_VALIDATE_VAR not set",
+		first + ":11:23: codelet_descriptor[0].in_io_channel[0].serde.protobuf.msg_name: message statuss not found in " + pbPath + ", did you mean status?",
+		first + ":13:20: codelet_descriptor[0].out_io_channel[0].stream_id: 00112233-4455-6677-8899-aabbccddeeff is shared by an out channel and an in channel at " + first + ":6:20",
+		first + ":18:20: codelet_descriptor[0].out_io_channel[1].stream_id: invalid UUID length: 10",
+		second + ":3:20: codelet_descriptor[0].out_io_channel[0].stream_id: 00112233-4455-6677-8899-aabbccddeeff is shared by an out channel and an in channel at " + first + ":6:20",
+		second + ":6:27: codelet_descriptor[0].out_io_channel[0].serde.protobuf.package_path: stat missing.pb: no such file or directory",
+	}, messages)
+}
+
+func TestValidateCodeletsetConfigFilesSyntaxError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("codeletset_id: a\ncodelet_descriptor:\n\t- codelet_name: a\n"), 0644))
+
+	problems := ValidateCodeletsetConfigFiles([]string{path}, nil, nil)
+	require.Len(t, problems, 1)
+	assert.Equal(t, 3, problems[0].Line)
+}
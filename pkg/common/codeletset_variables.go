@@ -0,0 +1,193 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ConfigVariables are the variables expanded in every string field of a codeletset config, on top of environment
+// variables. Values given with --set take precedence over values files, later values files over earlier ones, and
+// either over the environment.
+type ConfigVariables struct {
+	set         []string
+	valuesFiles []string
+
+	values map[string]string
+}
+
+// AddConfigVariablesToFlags adds the config variables to the provided flag set
+func AddConfigVariablesToFlags(flags *pflag.FlagSet, vars *ConfigVariables) {
+	if vars == nil {
+		return
+	}
+
+	flags.StringArrayVar(&vars.set, "set", []string{}, "set a variable expanded in the string fields of the configs as ${key}, given as key=value, overriding --values and environment variables. Numeric fields such as priority cannot reference variables")
+	flags.StringArrayVar(&vars.valuesFiles, "values", []string{}, "YAML, JSON or TOML file of variables expanded in the configs, nested keys are joined with dots, overriding environment variables")
+}
+
+// Parse the config variables
+func (v *ConfigVariables) Parse() error {
+	v.values = make(map[string]string)
+
+	for _, path := range v.valuesFiles {
+		data, err := readConfig(path)
+		if err != nil {
+			return fmt.Errorf("failed to read values file %s: %w", ConfigDisplayName(path), err)
+		}
+		values, err := decodeValues(data, DetectConfigFormat(path, data))
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal values file %s: %w", ConfigDisplayName(path), err)
+		}
+		for key, value := range values {
+			v.values[key] = value
+		}
+	}
+
+	for _, kv := range v.set {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || len(strings.TrimSpace(key)) == 0 {
+			return fmt.Errorf("expected --set to be key=value, got %s", kv)
+		}
+		v.values[strings.TrimSpace(key)] = value
+	}
+
+	return nil
+}
+
+// Lookup returns the value of a variable, falling back to the environment
+func (v *ConfigVariables) Lookup(name string) (string, bool) {
+	if v != nil {
+		if value, ok := v.values[name]; ok {
+			return value, true
+		}
+	}
+	return os.LookupEnv(name)
+}
+
+// decodeValues decodes a values file, flattening nested mappings into dotted keys
+func decodeValues(data []byte, format ConfigFormat) (map[string]string, error) {
+	doc, err := parseConfigNode(data, format)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+	var raw map[string]interface{}
+	if err := doc.Content[0].Decode(&raw); err != nil {
+		return nil, err
+	}
+	return values, flattenValues(values, "", raw)
+}
+
+func flattenValues(out map[string]string, prefix string, raw map[string]interface{}) error {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := key
+		if len(prefix) > 0 {
+			name = prefix + "." + key
+		}
+		switch value := raw[key].(type) {
+		case map[string]interface{}:
+			if err := flattenValues(out, name, value); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("%s: expected a scalar or a mapping, got a list", name)
+		case nil:
+			out[name] = ""
+		default:
+			out[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+// expandVariables expands $name, ${name} and ${name:-default} in a string, the default applying when the variable is
+// unset or empty. $$ is a literal $. It returns the names of variables which are unset and have no default.
+func expandVariables(s string, lookup func(string) (string, bool)) (string, []string) {
+	var b strings.Builder
+	unset := make([]string, 0)
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				b.WriteString(s[i:])
+				return b.String(), unset
+			}
+			name, def, hasDefault := strings.Cut(s[i+2:i+2+end], ":-")
+			value, ok := lookup(name)
+			switch {
+			case hasDefault && len(value) == 0:
+				value = def
+			case !ok:
+				unset = append(unset, name)
+			}
+			b.WriteString(value)
+			i += 2 + end
+		case isVariableChar(next):
+			end := i + 1
+			for end < len(s) && isVariableChar(s[end]) {
+				end++
+			}
+			name := s[i+1 : end]
+			value, ok := lookup(name)
+			if !ok {
+				unset = append(unset, name)
+			}
+			b.WriteString(value)
+			i = end - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), unset
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// expandRawConfig expands the variables of every string field of a raw config in place. As with environment variables
+// alone, unset variables expand to an empty string, ValidateCodeletsetConfigFiles reports them.
+func expandRawConfig(v reflect.Value, lookup func(string) (string, bool)) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandRawConfig(v.Elem(), lookup)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandRawConfig(v.Index(i), lookup)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			expandRawConfig(v.Field(i), lookup)
+		}
+	case reflect.String:
+		expanded, _ := expandVariables(v.String(), lookup)
+		v.SetString(expanded)
+	}
+}
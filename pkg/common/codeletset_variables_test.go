@@ -0,0 +1,83 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandVariables(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"a": "x", "b.c": "y", "empty": ""}[name]
+		return value, ok
+	}
+
+	testCases := []struct {
+		in       string
+		expected string
+		unset    []string
+	}{
+		{"plain", "plain", []string{}},
+		{"$a/${a}", "x/x", []string{}},
+		{"${b.c}", "y", []string{}},
+		{"${missing:-d}/${empty:-e}/${a:-f}", "d/e/x", []string{}},
+		{"$missing${missing2}", "", []string{"missing", "missing2"}},
+		{"$$a $", "$a $", []string{}},
+		{"${a", "${a", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			expanded, unset := expandVariables(tc.in, lookup)
+			assert.Equal(t, tc.expected, expanded)
+			assert.Equal(t, tc.unset, unset)
+		})
+	}
+}
+
+func TestConfigVariables(t *testing.T) {
+	t.Setenv("CELL", "env")
+	t.Setenv("ROOT", "/env")
+
+	dir := t.TempDir()
+	values := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(values, []byte("CELL: values\nstream:\n  out: 00112233445566778899aabbccddeeff\n"), 0644))
+	config := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`codeletset_id: cell_${CELL}
+codelet_descriptor:
+  - codelet_name: ${name:-default}
+    codelet_path: $ROOT/codelet.o
+    out_io_channel:
+      - stream_id: ${stream.out}
+`), 0644))
+
+	vars := &ConfigVariables{valuesFiles: []string{values}, set: []string{"CELL=set"}}
+	require.NoError(t, vars.Parse())
+	configs, err := CodeletsetConfigFromFiles(vars, config)
+	require.NoError(t, err)
+	assert.Equal(t, "cell_set", configs[0].CodeletsetID)
+	assert.Equal(t, "default", configs[0].CodeletDescriptor[0].CodeletName)
+	assert.Equal(t, "/env/codelet.o", configs[0].CodeletDescriptor[0].CodeletPath)
+	assert.Equal(t, "00112233-4455-6677-8899-aabbccddeeff", configs[0].CodeletDescriptor[0].OutIOChannel[0].StreamUUID.String())
+
+	vars = &ConfigVariables{valuesFiles: []string{values}}
+	require.NoError(t, vars.Parse())
+	rawConfigs, err := CodeletsetRawConfigFromFiles(vars, config)
+	require.NoError(t, err)
+	assert.Equal(t, "cell_values", rawConfigs[0].CodeletsetID)
+
+	// a rendered config loads as the same config
+	for _, format := range []ConfigFormat{ConfigFormatYAML, ConfigFormatJSON, ConfigFormatTOML} {
+		data, err := MarshalCodeletsetRawConfig(rawConfigs[0], format)
+		require.NoError(t, err)
+		rendered, err := decodeRawConfig(data, format)
+		require.NoError(t, err)
+		assert.Equal(t, rawConfigs[0], rendered, format)
+	}
+
+	vars = &ConfigVariables{set: []string{"novalue"}}
+	assert.ErrorContains(t, vars.Parse(), "expected --set to be key=value, got novalue")
+}
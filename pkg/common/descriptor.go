@@ -0,0 +1,137 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// FindInIOChannel returns the input IO channel with the given stream ID, which must have a protobuf schema
+func FindInIOChannel(configs []*CodeletsetConfig, streamUUID uuid.UUID) (*IOChannelConfig, error) {
+	for _, config := range configs {
+		for _, desc := range config.CodeletDescriptor {
+			for _, io := range desc.InIOChannel {
+				if io.StreamUUID != streamUUID {
+					continue
+				}
+				if !io.HasProtobuf() {
+					return nil, fmt.Errorf("stream %s has no serde.protobuf schema", streamUUID)
+				}
+				return io, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("stream %s not found in any of the loaded schemas", streamUUID)
+}
+
+// NewFilesFromCompiledProto interprets a compiled proto package
+func NewFilesFromCompiledProto(compiledProto []byte) (*protoregistry.Files, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(compiledProto, fds); err != nil {
+		return nil, err
+	}
+	return protodesc.NewFiles(fds)
+}
+
+// FindMessageDescriptor returns the descriptor of a message in a compiled proto package
+func FindMessageDescriptor(compiledProto []byte, msgName string) (protoreflect.MessageDescriptor, error) {
+	files, err := NewFilesFromCompiledProto(compiledProto)
+	if err != nil {
+		return nil, err
+	}
+	return findMessageInFiles(files, msgName)
+}
+
+func findMessageInFiles(files *protoregistry.Files, msgName string) (protoreflect.MessageDescriptor, error) {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(msgName))
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("failed to cast desc to protoreflect.MessageDescriptor, got %T", desc)
+	}
+
+	return md, nil
+}
+
+const maxSuggestions = 3
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// SuggestMessageNames returns the messages of the files whose full name is close to msgName, closest first. Names are
+// also compared without their package, as msg_name is often given without one.
+func SuggestMessageNames(files *protoregistry.Files, msgName string) []string {
+	type candidate struct {
+		distance int
+		name     string
+	}
+	candidates := make([]candidate, 0)
+	target := strings.ToLower(msgName)
+
+	var walk func(pkg protoreflect.FullName, mds protoreflect.MessageDescriptors)
+	walk = func(pkg protoreflect.FullName, mds protoreflect.MessageDescriptors) {
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			name := string(md.FullName())
+			relative := strings.TrimPrefix(strings.TrimPrefix(name, string(pkg)), ".")
+			distance := min(levenshtein(target, strings.ToLower(name)), levenshtein(target, strings.ToLower(relative)))
+			if distance <= max(2, len(msgName)/3) {
+				candidates = append(candidates, candidate{distance: distance, name: name})
+			}
+			walk(pkg, md.Messages())
+		}
+	}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		walk(fd.Package(), fd.Messages())
+		return true
+	})
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+
+	suggestions := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].name)
+	}
+	return suggestions
+}
+
+// messageNotFoundError returns an error for a message which is not defined in a compiled proto package, suggesting
+// close matches
+func messageNotFoundError(files *protoregistry.Files, msgName, packagePath string) error {
+	err := fmt.Errorf("message %s not found in %s", msgName, packagePath)
+	if suggestions := SuggestMessageNames(files, msgName); len(suggestions) > 0 {
+		err = fmt.Errorf("%w, did you mean %s?", err, strings.Join(suggestions, ", "))
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const testdataDir = "../../testdata"
+
+func TestSuggestMessageNames(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schema.proto"), []byte(`syntax = "proto3";
+package telemetry.v1;
+message packet { message header { int32 len = 1; } header hdr = 1; }
+message packets { repeated packet items = 1; }
+message manual_ctrl_event { int32 value = 1; }
+`), 0644))
+	protoPkg, err := loadCompiledProto(filepath.Join(dir, "schema.proto"), nil)
+	require.NoError(t, err)
+	files, err := NewFilesFromCompiledProto(protoPkg.Data)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		msgName  string
+		expected []string
+	}{
+		{"packet", []string{"telemetry.v1.packet", "telemetry.v1.packets"}},
+		{"telemetry.v1.pakcet", []string{"telemetry.v1.packet", "telemetry.v1.packets"}},
+		{"manual_ctrl_evnt", []string{"telemetry.v1.manual_ctrl_event"}},
+		{"packet.Header", []string{"telemetry.v1.packet.header"}},
+		{"unrelated", []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.msgName, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SuggestMessageNames(files, tc.msgName))
+		})
+	}
+}
+
+func TestLoadCompiledProtosChecksMsgName(t *testing.T) {
+	pbPath := filepath.Join(snapshotDir, "example1", "example.pb")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`codelet_descriptor:
+  - out_io_channel:
+      - stream_id: 00112233445566778899aabbccddeeff
+        serde:
+          protobuf:
+            package_path: `+pbPath+`
+            msg_name: stauts
+      - stream_id: 00112233445566778899aabbccddeef0
+        serde:
+          protobuf:
+            package_path: `+pbPath+`
+            msg_name: status
+`), 0644))
+
+	configs, err := CodeletsetConfigFromFiles(nil, path)
+	require.NoError(t, err)
+
+	_, err = LoadCompiledProtos(configs, nil, true, false)
+	assert.NoError(t, err)
+
+	_, err = LoadCompiledProtos(configs, nil, false, true)
+	assert.EqualError(t, err, "stream 00112233-4455-6677-8899-aabbccddeeff: message stauts not found in "+pbPath+", did you mean status?")
+}
+
+func TestLoadCompiledProtosFromSource(t *testing.T) {
+	protoPath, err := filepath.Abs(filepath.Join(testdataDir, "example1", "example.proto"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`codelet_descriptor:
+  - out_io_channel:
+      - stream_id: 00112233445566778899aabbccddeeff
+        serde:
+          protobuf:
+            package_path: `+protoPath+`
+            msg_name: status
+`), 0644))
+
+	configs, err := CodeletsetConfigFromFiles(nil, path)
+	require.NoError(t, err)
+	compiledProtos, err := LoadCompiledProtos(configs, nil, false, true)
+	require.NoError(t, err)
+	require.Contains(t, compiledProtos, protoPath)
+	assert.Equal(t, "example.pb", compiledProtos[protoPath].Name)
+
+	// the .proto source compiles to the same descriptor as the compiled snapshot
+	data, err := os.ReadFile(filepath.Join(snapshotDir, "example1", "example.pb"))
+	require.NoError(t, err)
+	expected, actual := &descriptorpb.FileDescriptorSet{}, &descriptorpb.FileDescriptorSet{}
+	require.NoError(t, proto.Unmarshal(data, expected))
+	require.NoError(t, proto.Unmarshal(compiledProtos[protoPath].Data, actual))
+	assert.True(t, proto.Equal(expected, actual), "expected %v, got %v", expected, actual)
+}
@@ -20,8 +20,13 @@ func RunSubprocess(ctx context.Context, logger *logrus.Logger, name string, args
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = os.Environ()
 	l.Debug("Running subprocess")
-	cmd.Stderr = logger.WithField("channel", "stderr").WriterLevel(logrus.ErrorLevel)
-	cmd.Stdout = logger.WithField("channel", "stdout").WriterLevel(logrus.DebugLevel)
+	// the writers log from a goroutine, which only ends once they are closed
+	stderr := logger.WithField("channel", "stderr").WriterLevel(logrus.ErrorLevel)
+	defer stderr.Close()
+	stdout := logger.WithField("channel", "stdout").WriterLevel(logrus.DebugLevel)
+	defer stdout.Close()
+	cmd.Stderr = stderr
+	cmd.Stdout = stdout
 	if err := cmd.Run(); err != nil {
 		l.Error(fmt.Errorf("failed to run command: %s with error %s", cmd, err))
 		return errors.Join(err)
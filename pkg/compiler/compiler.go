@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package compiler
+
+import (
+	"context"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/linker"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Compile compiles proto files into a FileDescriptorSet, equivalent to `protoc -o`. Imports are resolved relative to
+// the import paths, falling back to the well-known types, and the current directory is used when no import paths are
+// given. When includeImports is set, the imported files are added to the set before the files which depend on them.
+func Compile(ctx context.Context, protoFiles []string, importPaths []string, includeImports bool) (*descriptorpb.FileDescriptorSet, error) {
+	c := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: importPaths,
+		}),
+		SourceInfoMode: protocompile.SourceInfoNone,
+	}
+
+	files, err := c.Compile(ctx, protoFiles...)
+	if err != nil {
+		return nil, err
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		if includeImports {
+			for i := 0; i < fd.Imports().Len(); i++ {
+				add(fd.Imports().Get(i).FileDescriptor)
+			}
+		}
+		fds.File = append(fds.File, toFileDescriptorProto(fd))
+	}
+	for _, f := range files {
+		add(f)
+	}
+
+	return fds, nil
+}
+
+func toFileDescriptorProto(fd protoreflect.FileDescriptor) *descriptorpb.FileDescriptorProto {
+	if res, ok := fd.(linker.Result); ok {
+		return res.FileDescriptorProto()
+	}
+	return protodesc.ToFileDescriptorProto(fd)
+}
@@ -0,0 +1,71 @@
+package compiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	snapshotDir = "../__snapshots__"
+	testdataDir = "../../testdata"
+)
+
+func TestCompileMatchesProtoc(t *testing.T) {
+	testCases := []struct {
+		example          string
+		protoPackageName string
+	}{
+		{"example1", "example"},
+		{"example2", "example2"},
+		{"example3", "example3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.example, func(t *testing.T) {
+			fds, err := Compile(context.Background(), []string{tc.protoPackageName + ".proto"}, []string{filepath.Join(testdataDir, tc.example)}, false)
+			require.NoError(t, err)
+
+			data, err := proto.Marshal(fds)
+			require.NoError(t, err)
+			expected, err := os.ReadFile(filepath.Join(snapshotDir, tc.example, tc.protoPackageName+".pb"))
+			require.NoError(t, err)
+			assert.Equal(t, expected, data)
+		})
+	}
+}
+
+func TestCompileIncludeImports(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "dep.proto"), []byte(`syntax = "proto3";
+package dep;
+message Dep { int32 value = 1; }
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.proto"), []byte(`syntax = "proto3";
+import "dep.proto";
+import "google/protobuf/timestamp.proto";
+message Main { dep.Dep dep = 1; google.protobuf.Timestamp ts = 2; }
+`), 0644))
+
+	fds, err := Compile(context.Background(), []string{"main.proto"}, []string{dir}, true)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(fds.GetFile()))
+	for _, f := range fds.GetFile() {
+		names = append(names, f.GetName())
+	}
+	assert.Equal(t, []string{"dep.proto", "google/protobuf/timestamp.proto", "main.proto"}, names)
+
+	fds, err = Compile(context.Background(), []string{"main.proto"}, []string{dir}, false)
+	require.NoError(t, err)
+	require.Len(t, fds.GetFile(), 1)
+	assert.Equal(t, "main.proto", fds.GetFile()[0].GetName())
+
+	_, err = Compile(context.Background(), []string{"missing.proto"}, []string{dir}, false)
+	assert.Error(t, err)
+}
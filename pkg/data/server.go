@@ -16,7 +16,6 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -42,8 +41,8 @@ func NewServer(ctx context.Context, logger *logrus.Logger, opts *ServerOptions,
 	}, nil
 }
 
-// Listen starts the server
-func (s *Server) Listen(onData func(uuid.UUID, []byte)) error {
+// Listen starts the server, calling onData with each message decoded and its JSON encoding
+func (s *Server) Listen(onData func(*schema.DecodedMessage, []byte)) error {
 	data, err := net.ListenPacket(dataScheme, fmt.Sprintf("%s:%d", s.opts.dataIP, s.opts.dataPort))
 	if err != nil {
 		return err
@@ -90,25 +89,19 @@ func (s *Server) Listen(onData func(uuid.UUID, []byte)) error {
 				continue
 			}
 
-			msg, err := s.store.GetProtoMsgInstance(streamUUID)
+			msg, err := s.store.Decode(streamUUID, buffer[16:n])
 			if err != nil {
-				s.logger.WithError(err).Error("error creating instance of proto message")
+				s.logger.WithField("streamUUID", streamUUID.String()).WithError(err).Error("error decoding payload")
 				continue
 			}
 
-			err = proto.Unmarshal(buffer[16:n], msg)
-			if err != nil {
-				s.logger.WithError(err).Error("error unmarshalling payload")
-				continue
-			}
-
-			res, err := protojson.Marshal(msg)
+			res, err := protojson.Marshal(msg.Message)
 			if err != nil {
 				s.logger.WithError(err).Error("error marshalling message to JSON")
 				continue
 			}
 
-			onData(streamUUID, res)
+			onData(msg, res)
 		}
 	}
 
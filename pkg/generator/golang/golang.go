@@ -0,0 +1,203 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+const (
+	defaultProtocGenGo = "protoc-gen-go"
+	generatedFileMode  = fs.FileMode(0644)
+)
+
+// Options are the options for generating Go bindings
+type Options struct {
+	goOut       string
+	goPackage   string
+	protocGenGo string
+
+	absGoOut        string
+	protocGenGoPath string
+}
+
+// AddOptionsToFlags adds the options to the provided flag set
+func AddOptionsToFlags(flags *pflag.FlagSet, opts *Options) {
+	if opts == nil {
+		return
+	}
+
+	flags.StringVar(&opts.goOut, "go-out", "", "if set, Go message types are generated for each schema into this directory")
+	flags.StringVar(&opts.goPackage, "go-package", "", `Go import path of the generated Go package, e.g. "example.com/telemetry/schema". Required when the proto file has no go_package option`)
+	flags.StringVar(&opts.protocGenGo, "protoc-gen-go", defaultProtocGenGo, "protoc-gen-go plugin used to generate the Go message types")
+}
+
+// Parse the options
+func (o *Options) Parse() error {
+	if !o.Enabled() {
+		return nil
+	}
+
+	var err error
+	o.absGoOut, err = filepath.Abs(o.goOut)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(o.absGoOut); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf(`expected "%s" to be a directory`, o.absGoOut)
+	}
+
+	o.protocGenGoPath, err = exec.LookPath(o.protocGenGo)
+	if err != nil {
+		return fmt.Errorf("%s plugin not found, install it with `go install google.golang.org/protobuf/cmd/protoc-gen-go@latest`: %w", o.protocGenGo, err)
+	}
+
+	return nil
+}
+
+// Enabled returns true if Go bindings should be generated
+func (o *Options) Enabled() bool {
+	return o != nil && len(o.goOut) > 0
+}
+
+// OutputDir returns the directory Go bindings are generated into
+func (o *Options) OutputDir() string {
+	return o.absGoOut
+}
+
+// withDependencies returns the files in dependency order, adding any dependencies missing from the set which are
+// known to the global registry, such as the well-known types
+func withDependencies(files []*descriptorpb.FileDescriptorProto) ([]*descriptorpb.FileDescriptorProto, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, f := range files {
+		byName[f.GetName()] = f
+	}
+
+	ordered := make([]*descriptorpb.FileDescriptorProto, 0, len(files))
+	seen := make(map[string]bool)
+	var add func(f *descriptorpb.FileDescriptorProto) error
+	add = func(f *descriptorpb.FileDescriptorProto) error {
+		if seen[f.GetName()] {
+			return nil
+		}
+		seen[f.GetName()] = true
+		for _, dep := range f.GetDependency() {
+			depFile, ok := byName[dep]
+			if !ok {
+				fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+				if err != nil {
+					return fmt.Errorf("dependency %s of %s not found: %w", dep, f.GetName(), err)
+				}
+				depFile = protodesc.ToFileDescriptorProto(fd)
+			}
+			if err := add(depFile); err != nil {
+				return err
+			}
+		}
+		ordered = append(ordered, f)
+		return nil
+	}
+
+	for _, f := range files {
+		if err := add(f); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Generate generates Go message types for a proto package from its compiled FileDescriptorSet by running the
+// protoc-gen-go plugin
+func Generate(ctx context.Context, logger *logrus.Logger, opts *Options, protoPackageName string, descriptor []byte) ([]*common.File, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(descriptor, fds); err != nil {
+		return nil, err
+	}
+
+	protoFile := protoPackageName + ".proto"
+	var target *descriptorpb.FileDescriptorProto
+	for _, f := range fds.GetFile() {
+		if f.GetName() == protoFile {
+			target = f
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s not found in descriptor", protoFile)
+	}
+
+	params := []string{"paths=source_relative"}
+	if len(opts.goPackage) > 0 {
+		params = append(params, fmt.Sprintf("M%s=%s", protoFile, opts.goPackage))
+	} else if len(target.GetOptions().GetGoPackage()) == 0 {
+		return nil, fmt.Errorf("%s has no go_package option, set --go-package", protoFile)
+	}
+
+	files, err := withDependencies(fds.GetFile())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := proto.Marshal(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{protoFile},
+		Parameter:      proto.String(strings.Join(params, ",")),
+		ProtoFile:      files,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l := logger.WithField("cmd", opts.protocGenGoPath)
+	l.Debug("Running plugin")
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, opts.protocGenGoPath)
+	cmd.Env = os.Environ()
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	stderr := logger.WithField("channel", "stderr").WriterLevel(logrus.ErrorLevel)
+	defer stderr.Close()
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		l.WithError(err).Error("failed to run plugin")
+		return nil, err
+	}
+
+	resp := &pluginpb.CodeGeneratorResponse{}
+	if err := proto.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, errors.New(resp.GetError())
+	}
+
+	generatedFiles := make([]*common.File, 0, len(resp.GetFile()))
+	for _, f := range resp.GetFile() {
+		if len(f.GetInsertionPoint()) > 0 {
+			return nil, fmt.Errorf("%s: insertion points are not supported", f.GetName())
+		}
+		l.WithField("filename", f.GetName()).Debug("Generated file")
+		generatedFiles = append(generatedFiles, &common.File{
+			Data: []byte(f.GetContent()),
+			Mode: generatedFileMode,
+			Name: f.GetName(),
+		})
+	}
+
+	return generatedFiles, nil
+}
@@ -0,0 +1,145 @@
+package golang
+
+import (
+	"context"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+const fakePlugin = "protoc-gen-go-fake"
+
+// installFakePlugin puts a plugin on PATH which records its request and replies with the given response, or exits
+// with an error if resp is nil
+func installFakePlugin(t *testing.T, resp *pluginpb.CodeGeneratorResponse) (requestFile string) {
+	dir := t.TempDir()
+	requestFile = filepath.Join(dir, "request.bin")
+	script := "#!/bin/sh\ncat > " + requestFile + "\necho 'plugin failed' >&2\nexit 1\n"
+	if resp != nil {
+		data, err := proto.Marshal(resp)
+		require.NoError(t, err)
+		responseFile := filepath.Join(dir, "response.bin")
+		require.NoError(t, os.WriteFile(responseFile, data, 0644))
+		script = "#!/bin/sh\ncat > " + requestFile + "\ncat " + responseFile + "\n"
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, fakePlugin), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return
+}
+
+func parseOptions(t *testing.T, args ...string) (*Options, error) {
+	opts := &Options{}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddOptionsToFlags(flags, opts)
+	require.NoError(t, flags.Parse(append([]string{"--go-out", t.TempDir(), "--protoc-gen-go", fakePlugin}, args...)))
+	return opts, opts.Parse()
+}
+
+func compiledProto(t *testing.T, goPackage string) []byte {
+	file := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("pkg.proto"),
+		Package:     proto.String("pkg"),
+		Syntax:      proto.String("proto2"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("msg")}},
+	}
+	if len(goPackage) > 0 {
+		file.Options = &descriptorpb.FileOptions{GoPackage: proto.String(goPackage)}
+	}
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	require.NoError(t, err)
+	return data
+}
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		goPackage string
+		resp      *pluginpb.CodeGeneratorResponse
+		parameter string
+		expected  []*common.File
+		err       string
+	}{
+		{
+			name:      "go_package option",
+			goPackage: "example.com/pkg",
+			resp:      &pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{{Name: proto.String("pkg.pb.go"), Content: proto.String("package pkg\n")}}},
+			parameter: "paths=source_relative",
+			expected:  []*common.File{{Data: []byte("package pkg\n"), Mode: generatedFileMode, Name: "pkg.pb.go"}},
+		},
+		{
+			name:      "go package flag",
+			args:      []string{"--go-package", "example.com/other"},
+			resp:      &pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{{Name: proto.String("pkg.pb.go"), Content: proto.String("package other\n")}}},
+			parameter: "paths=source_relative,Mpkg.proto=example.com/other",
+			expected:  []*common.File{{Data: []byte("package other\n"), Mode: generatedFileMode, Name: "pkg.pb.go"}},
+		},
+		{
+			name: "missing go_package",
+			resp: &pluginpb.CodeGeneratorResponse{},
+			err:  "pkg.proto has no go_package option, set --go-package",
+		},
+		{
+			name:      "plugin error",
+			goPackage: "example.com/pkg",
+			resp:      &pluginpb.CodeGeneratorResponse{Error: proto.String("unsupported feature")},
+			parameter: "paths=source_relative",
+			err:       "unsupported feature",
+		},
+		{
+			name:      "insertion point",
+			goPackage: "example.com/pkg",
+			resp:      &pluginpb.CodeGeneratorResponse{File: []*pluginpb.CodeGeneratorResponse_File{{Name: proto.String("pkg.pb.go"), InsertionPoint: proto.String("imports")}}},
+			parameter: "paths=source_relative",
+			err:       "pkg.pb.go: insertion points are not supported",
+		},
+		{
+			name:      "plugin exits with an error",
+			goPackage: "example.com/pkg",
+			parameter: "paths=source_relative",
+			err:       "exit status 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requestFile := installFakePlugin(t, tc.resp)
+			opts, err := parseOptions(t, tc.args...)
+			require.NoError(t, err)
+
+			files, err := Generate(context.Background(), logrus.New(), opts, "pkg", compiledProto(t, tc.goPackage))
+			if len(tc.err) > 0 {
+				assert.ErrorContains(t, err, tc.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, files)
+			}
+
+			if len(tc.parameter) == 0 {
+				assert.NoFileExists(t, requestFile)
+				return
+			}
+			data, err := os.ReadFile(requestFile)
+			require.NoError(t, err)
+			req := &pluginpb.CodeGeneratorRequest{}
+			require.NoError(t, proto.Unmarshal(data, req))
+			assert.Equal(t, []string{"pkg.proto"}, req.GetFileToGenerate())
+			assert.Equal(t, tc.parameter, req.GetParameter())
+		})
+	}
+}
+
+func TestParseMissingPlugin(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := parseOptions(t)
+	assert.ErrorContains(t, err, fakePlugin+" plugin not found")
+}
@@ -0,0 +1,162 @@
+package header
+
+import (
+	"bytes"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Source is a codeletset config and the file it was loaded from
+type Source struct {
+	Config *common.CodeletsetConfig
+	Path   string
+}
+
+// Identifier converts a name to a valid C identifier, replacing any invalid characters with underscores
+func Identifier(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || r == '_'):
+			b.WriteRune(r)
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// GuardFromFilename returns an include guard for a header file name, e.g. STREAMS_H for streams.h
+func GuardFromFilename(filename string) string {
+	return strings.ToUpper(Identifier(filepath.Base(filename)))
+}
+
+// CTypeNames returns the name of the C struct nanopb generates for the message of each protobuf io channel of the
+// configs, applying the options of the .options file alongside its package_path
+func CTypeNames(cfgs []*common.CodeletsetConfig, compiledProtos map[string]*common.File) (map[common.ProtobufConfig]string, error) {
+	cTypeNames := make(map[common.ProtobufConfig]string)
+	for _, c := range cfgs {
+		for _, desc := range c.CodeletDescriptor {
+			for _, channels := range [][]*common.IOChannelConfig{desc.InIOChannel, desc.OutIOChannel} {
+				for _, io := range channels {
+					if !io.HasProtobuf() {
+						continue
+					}
+					protobuf := *io.Serde.Protobuf
+					if _, ok := cTypeNames[protobuf]; ok {
+						continue
+					}
+					compiledProto, ok := compiledProtos[protobuf.PackagePath]
+					if !ok {
+						return nil, fmt.Errorf("%s has not been compiled", protobuf.PackagePath)
+					}
+					md, err := common.FindMessageDescriptor(compiledProto.Data, protobuf.MsgName)
+					if err != nil {
+						return nil, err
+					}
+					opts, err := nanopb.LoadOptionsForProto(protobuf.PackagePath)
+					if err != nil {
+						return nil, err
+					}
+					cTypeNames[protobuf] = opts.CTypeName(md)
+				}
+			}
+		}
+	}
+	return cTypeNames, nil
+}
+
+type channel struct {
+	codelet string
+	dir     string
+	io      *common.IOChannelConfig
+	prefix  string
+}
+
+// Generate returns a C header defining the stream UUID and message type of each io channel of the codeletsets, see
+// CTypeNames for the message types. Identifiers are derived from the codelet and channel names, falling back to their
+// index when a name is missing.
+func Generate(guard, prefix string, sources []*Source, cTypeNames map[common.ProtobufConfig]string) ([]byte, error) {
+	channels := make([]*channel, 0)
+	seen := make(map[string]string)
+	for _, src := range sources {
+		for i, desc := range src.Config.CodeletDescriptor {
+			codelet := desc.CodeletName
+			if len(codelet) == 0 {
+				codelet = fmt.Sprintf("codelet%d", i)
+			}
+			for _, dir := range []struct {
+				name     string
+				short    string
+				channels []*common.IOChannelConfig
+			}{
+				{"in_io_channel", "in", desc.InIOChannel},
+				{"out_io_channel", "out", desc.OutIOChannel},
+			} {
+				for j, io := range dir.channels {
+					name := io.Name
+					if len(name) == 0 {
+						name = fmt.Sprintf("%s%d", dir.short, j)
+					}
+					p := strings.ToUpper(Identifier(prefix + codelet + "_" + name))
+					location := fmt.Sprintf("%s: %s %s %s", src.Path, codelet, dir.name, name)
+					if other, ok := seen[p]; ok {
+						return nil, fmt.Errorf("%s and %s both define %s, set distinct codelet_name and name values", other, location, p)
+					}
+					seen[p] = location
+					channels = append(channels, &channel{codelet: codelet, dir: dir.name, io: io, prefix: p})
+				}
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by jbpf_protobuf_cli config header. DO NOT EDIT.\n")
+	for _, src := range sources {
+		fmt.Fprintf(&b, "// source: %s\n", filepath.Base(src.Path))
+	}
+	fmt.Fprintf(&b, "\n#ifndef %s\n#define %s\n\n#include <stdint.h>\n", guard, guard)
+	// only GCC compatible compilers, such as clang, support the attribute silencing unused stream ID warnings
+	unused := guard + "_UNUSED"
+	fmt.Fprintf(&b, "\n#ifdef __GNUC__\n#define %s __attribute__((unused))\n#else\n#define %s\n#endif\n", unused, unused)
+
+	for _, c := range channels {
+		name := c.io.Name
+		if len(name) == 0 {
+			name = "(unnamed)"
+		}
+		id := c.io.StreamUUID
+		initializer := make([]string, len(id))
+		for i, v := range id {
+			initializer[i] = fmt.Sprintf("0x%02x", v)
+		}
+		if !c.io.HasProtobuf() {
+			fmt.Fprintf(&b, "\n/* %s %s %s */\n", c.codelet, c.dir, name)
+		} else {
+			fmt.Fprintf(&b, "\n/* %s %s %s: %s */\n", c.codelet, c.dir, name, c.io.Serde.Protobuf.MsgName)
+		}
+		fmt.Fprintf(&b, "#define %s_STREAM_ID_STR \"%s\"\n", c.prefix, strings.ReplaceAll(id.String(), "-", ""))
+		fmt.Fprintf(&b, "#define %s_STREAM_ID { %s }\n", c.prefix, strings.Join(initializer, ", "))
+		fmt.Fprintf(&b, "static const uint8_t %s_stream_id[16] %s = %s_STREAM_ID;\n", strings.ToLower(c.prefix), unused, c.prefix)
+		if c.io.HasProtobuf() {
+			cTypeName, ok := cTypeNames[*c.io.Serde.Protobuf]
+			if !ok {
+				return nil, fmt.Errorf("no C type name for %s in %s", c.io.Serde.Protobuf.MsgName, c.io.Serde.Protobuf.PackagePath)
+			}
+			fmt.Fprintf(&b, "#define %s_MSG_NAME \"%s\"\n", c.prefix, c.io.Serde.Protobuf.MsgName)
+			fmt.Fprintf(&b, "#define %s_MSG_TYPE %s\n", c.prefix, cTypeName)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n#endif /* %s */\n", guard)
+	return b.Bytes(), nil
+}
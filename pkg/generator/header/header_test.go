@@ -0,0 +1,206 @@
+package header
+
+import (
+	"jbpf_protobuf_cli/common"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentifier(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"codelet", "codelet"},
+		{"my_codelet2", "my_codelet2"},
+		{"my-codelet.v1", "my_codelet_v1"},
+		{"2nd", "_2nd"},
+		{"café", "caf_"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Identifier(tc.name))
+		})
+	}
+}
+
+func TestGuardFromFilename(t *testing.T) {
+	testCases := []struct {
+		filename string
+		expected string
+	}{
+		{"streams.h", "STREAMS_H"},
+		{"include/jbpf-streams.h", "JBPF_STREAMS_H"},
+		{"/abs/path/1streams.hpp", "_1STREAMS_HPP"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.filename, func(t *testing.T) {
+			assert.Equal(t, tc.expected, GuardFromFilename(tc.filename))
+		})
+	}
+}
+
+func protobufChannel(name, streamID, msgName string) *common.IOChannelConfig {
+	return &common.IOChannelConfig{
+		Name:       name,
+		Serde:      &common.SerdeConfig{Protobuf: &common.ProtobufConfig{MsgName: msgName, PackagePath: "pkg.proto"}},
+		StreamUUID: uuid.MustParse(streamID),
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	cTypeNames := map[common.ProtobufConfig]string{
+		{MsgName: "pkg.packet", PackagePath: "pkg.proto"}: "packet",
+	}
+
+	testCases := []struct {
+		name     string
+		prefix   string
+		sources  []*Source
+		expected string
+		err      string
+	}{
+		{
+			name: "protobuf",
+			sources: []*Source{{Path: "dir/load.yaml", Config: &common.CodeletsetConfig{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+				CodeletName:  "example_codelet",
+				OutIOChannel: []*common.IOChannelConfig{protobufChannel("outmap", "00112233-4455-6677-8899-aabbccddeeff", "pkg.packet")},
+			}}}}},
+			expected: `// Code generated by jbpf_protobuf_cli config header. DO NOT EDIT.
+// source: load.yaml
+
+#ifndef STREAMS_H
+#define STREAMS_H
+
+#include <stdint.h>
+
+#ifdef __GNUC__
+#define STREAMS_H_UNUSED __attribute__((unused))
+#else
+#define STREAMS_H_UNUSED
+#endif
+
+/* example_codelet out_io_channel outmap: pkg.packet */
+#define EXAMPLE_CODELET_OUTMAP_STREAM_ID_STR "00112233445566778899aabbccddeeff"
+#define EXAMPLE_CODELET_OUTMAP_STREAM_ID { 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff }
+static const uint8_t example_codelet_outmap_stream_id[16] STREAMS_H_UNUSED = EXAMPLE_CODELET_OUTMAP_STREAM_ID;
+#define EXAMPLE_CODELET_OUTMAP_MSG_NAME "pkg.packet"
+#define EXAMPLE_CODELET_OUTMAP_MSG_TYPE packet
+
+#endif /* STREAMS_H */
+`,
+		},
+		{
+			name:   "unnamed without serde",
+			prefix: "jbpf_",
+			sources: []*Source{{Path: "load.yaml", Config: &common.CodeletsetConfig{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+				InIOChannel: []*common.IOChannelConfig{{StreamUUID: uuid.MustParse("00000000-0000-0000-0000-000000000001")}},
+			}}}}},
+			expected: `// Code generated by jbpf_protobuf_cli config header. DO NOT EDIT.
+// source: load.yaml
+
+#ifndef STREAMS_H
+#define STREAMS_H
+
+#include <stdint.h>
+
+#ifdef __GNUC__
+#define STREAMS_H_UNUSED __attribute__((unused))
+#else
+#define STREAMS_H_UNUSED
+#endif
+
+/* codelet0 in_io_channel (unnamed) */
+#define JBPF_CODELET0_IN0_STREAM_ID_STR "00000000000000000000000000000001"
+#define JBPF_CODELET0_IN0_STREAM_ID { 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01 }
+static const uint8_t jbpf_codelet0_in0_stream_id[16] STREAMS_H_UNUSED = JBPF_CODELET0_IN0_STREAM_ID;
+
+#endif /* STREAMS_H */
+`,
+		},
+		{
+			name: "duplicate identifiers",
+			sources: []*Source{
+				{Path: "a.yaml", Config: &common.CodeletsetConfig{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+					CodeletName:  "c",
+					OutIOChannel: []*common.IOChannelConfig{protobufChannel("out", "00000000-0000-0000-0000-000000000001", "pkg.packet")},
+				}}}},
+				{Path: "b.yaml", Config: &common.CodeletsetConfig{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+					CodeletName:  "c",
+					OutIOChannel: []*common.IOChannelConfig{protobufChannel("out", "00000000-0000-0000-0000-000000000002", "pkg.packet")},
+				}}}},
+			},
+			err: "a.yaml: c out_io_channel out and b.yaml: c out_io_channel out both define C_OUT",
+		},
+		{
+			name: "unresolved message type",
+			sources: []*Source{{Path: "load.yaml", Config: &common.CodeletsetConfig{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+				CodeletName:  "c",
+				OutIOChannel: []*common.IOChannelConfig{protobufChannel("out", "00000000-0000-0000-0000-000000000001", "pkg.other")},
+			}}}}},
+			err: "no C type name for pkg.other in pkg.proto",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := Generate("STREAMS_H", tc.prefix, tc.sources, cTypeNames)
+			if len(tc.err) > 0 {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(data))
+		})
+	}
+}
+
+func TestCTypeNames(t *testing.T) {
+	dir := t.TempDir()
+	packagePath := filepath.Join(dir, "pkg.proto")
+	require.NoError(t, os.WriteFile(packagePath, []byte("syntax = \"proto2\";\npackage my.pkg;\nmessage msg {\n  message inner { optional int32 x = 1; }\n  optional inner i = 1;\n}\n"), 0644))
+
+	cfgs := []*common.CodeletsetConfig{{CodeletDescriptor: []*common.CodeletDescriptorConfig{{
+		InIOChannel: []*common.IOChannelConfig{{Serde: &common.SerdeConfig{Protobuf: &common.ProtobufConfig{MsgName: "my.pkg.msg", PackagePath: packagePath}}}},
+		OutIOChannel: []*common.IOChannelConfig{
+			{Serde: &common.SerdeConfig{Protobuf: &common.ProtobufConfig{MsgName: "my.pkg.msg.inner", PackagePath: packagePath}}},
+			{},
+		},
+	}}}}
+	compiledProtos, err := common.LoadCompiledProtos(cfgs, []string{}, true, true)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		options  string
+		expected map[string]string
+	}{
+		{"", map[string]string{"my.pkg.msg": "my_pkg_msg", "my.pkg.msg.inner": "my_pkg_msg_inner"}},
+		{"pkg.proto mangle_names:M_STRIP_PACKAGE\n", map[string]string{"my.pkg.msg": "msg", "my.pkg.msg.inner": "msg_inner"}},
+		{"pkg.proto mangle_names:M_FLATTEN\n", map[string]string{"my.pkg.msg": "msg", "my.pkg.msg.inner": "inner"}},
+		{"pkg.proto mangle_names:M_PACKAGE_INITIALS\n", map[string]string{"my.pkg.msg": "mp_msg", "my.pkg.msg.inner": "mp_msg_inner"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.options, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "pkg.options"), []byte(tc.options), 0644))
+			cTypeNames, err := CTypeNames(cfgs, compiledProtos)
+			require.NoError(t, err)
+			expected := make(map[common.ProtobufConfig]string)
+			for msgName, cTypeName := range tc.expected {
+				expected[common.ProtobufConfig{MsgName: msgName, PackagePath: packagePath}] = cTypeName
+			}
+			assert.Equal(t, expected, cTypeNames)
+		})
+	}
+
+	_, err = CTypeNames(cfgs, map[string]*common.File{})
+	assert.ErrorContains(t, err, "has not been compiled")
+}
@@ -0,0 +1,124 @@
+package nanopb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Issue describes why a message cannot be represented by nanopb as a fixed-size struct
+type Issue struct {
+	Name   protoreflect.FullName
+	Reason string
+}
+
+func (i *Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Name, i.Reason)
+}
+
+// Allocation returns the allocation type nanopb will use for a field
+func (o *Options) Allocation(fd protoreflect.FieldDescriptor) (FieldType, error) {
+	opts := o.ForField(fd)
+	_, hasMaxSize := opts.MaxSize()
+	if _, hasMaxLength := opts.MaxLength(); hasMaxLength && fd.Kind() == protoreflect.StringKind {
+		hasMaxSize = true
+	}
+	_, hasMaxCount := opts.MaxCount()
+
+	canBeStatic := true
+	if fd.Cardinality() == protoreflect.Repeated && !hasMaxCount {
+		canBeStatic = false
+	}
+	if (fd.Kind() == protoreflect.StringKind || fd.Kind() == protoreflect.BytesKind) && !hasMaxSize {
+		canBeStatic = false
+	}
+
+	t := opts.Type()
+	switch t {
+	case FieldTypeDefault:
+		if canBeStatic {
+			t = FieldTypeStatic
+		} else {
+			t = opts.FallbackType()
+		}
+	case FieldTypeInline:
+		t = FieldTypeStatic
+	}
+
+	if t == FieldTypeStatic && !canBeStatic {
+		return t, fmt.Errorf("field is defined as static, but max_size or max_count is not given")
+	}
+	if opts.FixedCount() && !hasMaxCount {
+		return t, fmt.Errorf("field is defined as fixed count, but max_count is not given")
+	}
+	return t, nil
+}
+
+func callbackReason(fd protoreflect.FieldDescriptor, t FieldType) string {
+	switch {
+	case t == FieldTypePointer:
+		return "field type is FT_POINTER, it would be generated as a pointer"
+	case fd.IsMap():
+		return "map field without max_count would be generated as pb_callback_t"
+	case fd.Cardinality() == protoreflect.Repeated:
+		return "repeated field without max_count would be generated as pb_callback_t"
+	case fd.Kind() == protoreflect.StringKind:
+		return "string field without max_size or max_length would be generated as pb_callback_t"
+	case fd.Kind() == protoreflect.BytesKind:
+		return "bytes field without max_size would be generated as pb_callback_t"
+	default:
+		return "field type is FT_CALLBACK, it would be generated as pb_callback_t"
+	}
+}
+
+// CheckMessage returns the issues which prevent nanopb representing a message, including any submessages, as a
+// fixed-size contiguous struct. A message without issues can be used as a jbpf io channel type.
+func (o *Options) CheckMessage(md protoreflect.MessageDescriptor) []*Issue {
+	return o.checkMessage(md, map[protoreflect.FullName]bool{}, map[protoreflect.FullName]bool{})
+}
+
+func (o *Options) checkMessage(md protoreflect.MessageDescriptor, stack, checked map[protoreflect.FullName]bool) []*Issue {
+	issues := make([]*Issue, 0)
+	if checked[md.FullName()] {
+		return issues
+	}
+	stack[md.FullName()] = true
+	defer func() {
+		delete(stack, md.FullName())
+		checked[md.FullName()] = true
+	}()
+
+	if o.ForMessage(md).SkipMessage() {
+		issues = append(issues, &Issue{Name: md.FullName(), Reason: "skip_message is set, no struct is generated"})
+	}
+	if md.ExtensionRanges().Len() > 0 {
+		issues = append(issues, &Issue{Name: md.FullName(), Reason: "message declares extension ranges, nanopb adds an extensions pointer"})
+	}
+
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		t, err := o.Allocation(fd)
+		if err != nil {
+			issues = append(issues, &Issue{Name: fd.FullName(), Reason: err.Error()})
+			continue
+		}
+		switch t {
+		case FieldTypeIgnore:
+			continue
+		case FieldTypeStatic:
+		default:
+			issues = append(issues, &Issue{Name: fd.FullName(), Reason: callbackReason(fd, t)})
+			continue
+		}
+
+		if sub := fd.Message(); sub != nil {
+			if stack[sub.FullName()] {
+				issues = append(issues, &Issue{Name: fd.FullName(), Reason: fmt.Sprintf("recursive reference to %s cannot be a fixed-size struct", sub.FullName())})
+				continue
+			}
+			issues = append(issues, o.checkMessage(sub, stack, checked)...)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,241 @@
+package nanopb
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	defaultCC                 = "cc"
+	defaultPbField32Bit       = "1"
+	envVarPbField32Bit        = "PB_FIELD_32BIT"
+	envVarPbMaxRequiredFields = "PB_MAX_REQUIRED_FIELDS"
+)
+
+// CompilerOptions are the options used to compile C sources against nanopb
+type CompilerOptions struct {
+	cc      string
+	cflags  []string
+	defines []string
+	ldflags []string
+	// layoutOnly is set when the options only describe the target of a layout estimate, and no compiler is invoked
+	layoutOnly bool
+	sysroot    string
+	target     string
+}
+
+// AddCompilerOptionsToFlags adds the compiler options to the provided flag set
+func AddCompilerOptionsToFlags(flags *pflag.FlagSet, opts *CompilerOptions) {
+	if opts == nil {
+		return
+	}
+
+	flags.StringVar(&opts.cc, "cc", defaultCC, "C compiler used to build the serializer libraries")
+	flags.StringArrayVar(&opts.cflags, "cflags", []string{}, `additional flag passed to the C compiler, repeat for each flag, e.g. --cflags -O2 --cflags -g`)
+	flags.StringArrayVar(&opts.ldflags, "ldflags", []string{}, "additional flag passed to the linker, repeat for each flag")
+	flags.StringVar(&opts.sysroot, "sysroot", "", "sysroot passed to the C compiler when cross compiling")
+	addTargetToFlags(flags, opts)
+}
+
+// AddTargetOptionsToFlags adds only the options which affect the layout of the nanopb structs to the provided flag
+// set, for commands which estimate the layout without compiling
+func AddTargetOptionsToFlags(flags *pflag.FlagSet, opts *CompilerOptions) {
+	if opts == nil {
+		return
+	}
+
+	opts.layoutOnly = true
+	addTargetToFlags(flags, opts)
+}
+
+func addTargetToFlags(flags *pflag.FlagSet, opts *CompilerOptions) {
+	flags.StringArrayVarP(&opts.defines, "define", "D", []string{}, `additional preprocessor definitions for nanopb, in the form "NAME" or "NAME=VALUE", e.g. PB_ENABLE_MALLOC`)
+	flags.StringVar(&opts.target, "target", "", `target triple passed to clang as "--target", e.g. aarch64-linux-gnu. For GCC cross toolchains set --cc instead, e.g. aarch64-linux-gnu-gcc`)
+}
+
+// isClang returns whether the C compiler is clang, following symlinks such as cc -> clang
+func isClang(cc string) bool {
+	if strings.Contains(filepath.Base(cc), "clang") {
+		return true
+	}
+	path, err := exec.LookPath(cc)
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	return err == nil && strings.Contains(filepath.Base(resolved), "clang")
+}
+
+// Parse the options
+func (o *CompilerOptions) Parse() error {
+	if !o.layoutOnly {
+		if len(strings.TrimSpace(o.cc)) == 0 {
+			return fmt.Errorf("C compiler must not be empty")
+		}
+		if len(o.target) > 0 && !isClang(o.cc) {
+			return fmt.Errorf("--target is only supported by clang, set --cc to clang or to a GCC cross compiler such as %s-gcc instead", o.target)
+		}
+	}
+	cflagsDefines, _, err := o.splitCFlags()
+	if err != nil {
+		return err
+	}
+	for _, d := range append(cflagsDefines, o.defines...) {
+		if name, _, _ := strings.Cut(d, "="); len(strings.TrimSpace(name)) == 0 {
+			return fmt.Errorf(`invalid definition "%s"`, d)
+		}
+	}
+	return nil
+}
+
+// CC returns the C compiler to invoke
+func (o *CompilerOptions) CC() string {
+	if o == nil || len(o.cc) == 0 {
+		return defaultCC
+	}
+	return o.cc
+}
+
+// definedNames returns the names of the definitions in the form "NAME" or "NAME=VALUE"
+func definedNames(defines []string) map[string]bool {
+	names := make(map[string]bool)
+	for _, d := range defines {
+		name, _, _ := strings.Cut(d, "=")
+		names[name] = true
+	}
+	return names
+}
+
+// splitCFlags splits the additional compiler flags into the definitions they contain, passed as "-DNAME" or
+// "-D NAME", and the other flags
+func (o *CompilerOptions) splitCFlags() (defines []string, flags []string, err error) {
+	defines, flags = []string{}, []string{}
+	if o == nil {
+		return
+	}
+	for i := 0; i < len(o.cflags); i++ {
+		switch {
+		case o.cflags[i] == "-D":
+			if i+1 == len(o.cflags) {
+				return nil, nil, fmt.Errorf(`"-D" in --cflags must be followed by a definition`)
+			}
+			i++
+			defines = append(defines, o.cflags[i])
+		case strings.HasPrefix(o.cflags[i], "-D"):
+			defines = append(defines, strings.TrimPrefix(o.cflags[i], "-D"))
+		default:
+			flags = append(flags, o.cflags[i])
+		}
+	}
+	return
+}
+
+// Defines returns the preprocessor definitions, including the nanopb defaults taken from the environment and those
+// passed in the additional compiler flags. Definitions provided with --define take precedence over the compiler flags,
+// which take precedence over the defaults.
+func (o *CompilerOptions) Defines() []string {
+	defines := make([]string, 0)
+	// the flags are checked by Parse
+	cflagsDefines, _, _ := o.splitCFlags()
+	explicit := make([]string, 0)
+	if o != nil {
+		explicit = o.defines
+	}
+	explicitNames, cflagsNames := definedNames(explicit), definedNames(cflagsDefines)
+	overridden := func(name string) bool { return explicitNames[name] || cflagsNames[name] }
+
+	pbField32Bit := os.Getenv(envVarPbField32Bit)
+	if pbField32Bit == "" {
+		pbField32Bit = defaultPbField32Bit
+	}
+	if !overridden(envVarPbField32Bit) {
+		defines = append(defines, envVarPbField32Bit+"="+pbField32Bit)
+	}
+	if pbMaxRequiredFields := os.Getenv(envVarPbMaxRequiredFields); len(pbMaxRequiredFields) > 0 && !overridden(envVarPbMaxRequiredFields) {
+		defines = append(defines, envVarPbMaxRequiredFields+"="+pbMaxRequiredFields)
+	}
+
+	for _, d := range cflagsDefines {
+		if name, _, _ := strings.Cut(d, "="); !explicitNames[name] {
+			defines = append(defines, d)
+		}
+	}
+	return append(defines, explicit...)
+}
+
+// CompileArgs returns the arguments passed to the C compiler ahead of the sources. Definitions in the additional
+// compiler flags are passed along with the others, see Defines.
+func (o *CompilerOptions) CompileArgs() []string {
+	args := make([]string, 0)
+	if o != nil && len(o.target) > 0 {
+		args = append(args, "--target="+o.target)
+	}
+	if o != nil && len(o.sysroot) > 0 {
+		args = append(args, "--sysroot="+o.sysroot)
+	}
+	args = append(args, "-I", Path)
+	for _, d := range o.Defines() {
+		args = append(args, "-D"+d)
+	}
+	_, cflags, _ := o.splitCFlags()
+	return append(args, cflags...)
+}
+
+// LinkArgs returns the arguments passed to the C compiler after the sources
+func (o *CompilerOptions) LinkArgs() []string {
+	if o == nil {
+		return []string{}
+	}
+	return append([]string{}, o.ldflags...)
+}
+
+// BuildInfo describes how a library was built. Paths under the nanopb root are recorded relative to $NANO_PB, so the
+// same build gives the same description on every machine.
+type BuildInfo struct {
+	Args    []string `json:"args"`
+	CC      string   `json:"cc"`
+	CFlags  []string `json:"cflags"`
+	Defines []string `json:"defines"`
+	LDFlags []string `json:"ldflags"`
+	Sysroot string   `json:"sysroot"`
+	Target  string   `json:"target"`
+}
+
+// relativeToNanopb returns an argument with the nanopb root replaced by $NANO_PB if it is a path under the root
+func relativeToNanopb(arg string) string {
+	if len(Path) == 0 {
+		return arg
+	}
+	root, cleaned := filepath.Clean(Path), filepath.Clean(arg)
+	if cleaned == root {
+		return "$" + nanoPbEnvVar
+	}
+	if rel, ok := strings.CutPrefix(cleaned, root+string(filepath.Separator)); ok {
+		return "$" + nanoPbEnvVar + "/" + filepath.ToSlash(rel)
+	}
+	return arg
+}
+
+// BuildInfo returns a description of the build for the given compiler arguments
+func (o *CompilerOptions) BuildInfo(args []string) *BuildInfo {
+	info := &BuildInfo{
+		Args:    make([]string, len(args)),
+		CC:      o.CC(),
+		Defines: o.Defines(),
+		LDFlags: o.LinkArgs(),
+	}
+	for i, arg := range args {
+		info.Args[i] = relativeToNanopb(arg)
+	}
+	_, info.CFlags, _ = o.splitCFlags()
+	if o != nil {
+		info.Sysroot = o.sysroot
+		info.Target = o.target
+	}
+	return info
+}
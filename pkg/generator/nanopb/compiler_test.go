@@ -0,0 +1,165 @@
+package nanopb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNanopbPath = "/opt/nanopb"
+
+func parseCompilerOptions(t *testing.T, args ...string) *CompilerOptions {
+	opts := &CompilerOptions{}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddCompilerOptionsToFlags(flags, opts)
+	require.NoError(t, flags.Parse(args))
+	require.NoError(t, opts.Parse())
+	return opts
+}
+
+func setNanopbPath(t *testing.T, path string) {
+	previous := Path
+	Path = path
+	t.Cleanup(func() { Path = previous })
+}
+
+func TestCompileArgs(t *testing.T) {
+	setNanopbPath(t, testNanopbPath)
+
+	testCases := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name:     "defaults",
+			expected: []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=1"},
+		},
+		{
+			name:     "environment",
+			env:      map[string]string{envVarPbField32Bit: "0", envVarPbMaxRequiredFields: "128"},
+			expected: []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=0", "-DPB_MAX_REQUIRED_FIELDS=128"},
+		},
+		{
+			name:     "cross compiling",
+			args:     []string{"--cc", "clang", "--target", "aarch64-linux-gnu", "--sysroot", "/opt/sysroots/aarch64", "--cflags", "-O2", "--cflags", "-g"},
+			expected: []string{"--target=aarch64-linux-gnu", "--sysroot=/opt/sysroots/aarch64", "-I", testNanopbPath, "-DPB_FIELD_32BIT=1", "-O2", "-g"},
+		},
+		{
+			name:     "defines",
+			args:     []string{"-D", "PB_ENABLE_MALLOC", "--define", "PB_FIELD_32BIT=0"},
+			env:      map[string]string{envVarPbField32Bit: "1"},
+			expected: []string{"-I", testNanopbPath, "-DPB_ENABLE_MALLOC", "-DPB_FIELD_32BIT=0"},
+		},
+		{
+			name:     "defines in cflags",
+			args:     []string{"--cflags", "-O2", "--cflags", "-DPB_FIELD_32BIT=0", "--cflags", "-D", "--cflags", "PB_NO_ERRMSG"},
+			expected: []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=0", "-DPB_NO_ERRMSG", "-O2"},
+		},
+		{
+			name:     "flag with spaces",
+			args:     []string{"--cflags", "-I/opt/my headers"},
+			expected: []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=1", "-I/opt/my headers"},
+		},
+		{
+			name:     "defines take precedence over cflags",
+			args:     []string{"--cflags=-DPB_FIELD_32BIT=0", "--cflags=-D", "--cflags=PB_NO_ERRMSG", "--cflags=-Wall", "-D", "PB_FIELD_32BIT=1", "-D", "PB_NO_ERRMSG=0"},
+			expected: []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=1", "-DPB_NO_ERRMSG=0", "-Wall"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envVarPbField32Bit, "")
+			t.Setenv(envVarPbMaxRequiredFields, "")
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			assert.Equal(t, tc.expected, parseCompilerOptions(t, tc.args...).CompileArgs())
+		})
+	}
+
+	var nilOpts *CompilerOptions
+	assert.Equal(t, []string{"-I", testNanopbPath, "-DPB_FIELD_32BIT=1"}, nilOpts.CompileArgs())
+}
+
+func TestInvalidOptions(t *testing.T) {
+	testCases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"empty define", []string{"-D", "=1"}, `invalid definition "=1"`},
+		{"empty define in cflags", []string{"--cflags", "-D=1"}, `invalid definition "=1"`},
+		{"trailing define in cflags", []string{"--cflags", "-O2", "--cflags", "-D"}, `"-D" in --cflags must be followed by a definition`},
+		{"empty compiler", []string{"--cc", " "}, "C compiler must not be empty"},
+		{"target with gcc", []string{"--cc", "gcc", "--target", "aarch64-linux-gnu"}, "--target is only supported by clang, set --cc to clang or to a GCC cross compiler such as aarch64-linux-gnu-gcc instead"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &CompilerOptions{}
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			AddCompilerOptionsToFlags(flags, opts)
+			require.NoError(t, flags.Parse(tc.args))
+			assert.EqualError(t, opts.Parse(), tc.err)
+		})
+	}
+}
+
+func TestTargetOptions(t *testing.T) {
+	opts := &CompilerOptions{}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddTargetOptionsToFlags(flags, opts)
+	require.NoError(t, flags.Parse([]string{"--target", "i686-linux-gnu", "-D", "PB_FIELD_32BIT"}))
+	// the compiler is never invoked, so the target does not need clang
+	require.NoError(t, opts.Parse())
+	assert.Equal(t, &LayoutOptions{Int64Align: 4, PbSizeTSize: 4}, NewLayoutOptions(opts))
+}
+
+func TestLinkArgs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{"none", []string{}, []string{}},
+		{"ldflags", []string{"--ldflags", "-lm", "--ldflags", "-Wl,--as-needed"}, []string{"-lm", "-Wl,--as-needed"}},
+		{"cflags are not linker flags", []string{"--cflags", "-O2"}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseCompilerOptions(t, tc.args...).LinkArgs())
+		})
+	}
+
+	var nilOpts *CompilerOptions
+	assert.Equal(t, []string{}, nilOpts.LinkArgs())
+}
+
+func TestBuildInfo(t *testing.T) {
+	setNanopbPath(t, testNanopbPath+"/")
+	t.Setenv(envVarPbField32Bit, "")
+	t.Setenv(envVarPbMaxRequiredFields, "")
+
+	opts := parseCompilerOptions(t, "--cc", "clang", "--target", "aarch64-linux-gnu", "--cflags", "-O2", "--cflags", "-DPB_NO_ERRMSG", "--ldflags", "-lm")
+	args := append(opts.CompileArgs(), "a.c", testNanopbPath+"/pb_common.c", testNanopbPath+"2/pb_encode.c", "-o", "a.so")
+	args = append(args, opts.LinkArgs()...)
+
+	data, err := json.Marshal(opts.BuildInfo(args))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"args": ["--target=aarch64-linux-gnu", "-I", "$NANO_PB", "-DPB_FIELD_32BIT=1", "-DPB_NO_ERRMSG", "-O2", "a.c", "$NANO_PB/pb_common.c", "/opt/nanopb2/pb_encode.c", "-o", "a.so", "-lm"],
+		"cc": "clang",
+		"cflags": ["-O2"],
+		"defines": ["PB_FIELD_32BIT=1", "PB_NO_ERRMSG"],
+		"ldflags": ["-lm"],
+		"sysroot": "",
+		"target": "aarch64-linux-gnu"
+	}`, string(data))
+}
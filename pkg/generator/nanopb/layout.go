@@ -0,0 +1,359 @@
+package nanopb
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	pbField32BitDefine = "PB_FIELD_32BIT"
+)
+
+// Member is a member of a C struct generated by nanopb
+type Member struct {
+	// Field is the proto field the member holds, or is the has/count companion of
+	Field  protoreflect.FieldDescriptor `json:"-"`
+	Name   string
+	CType  string
+	Offset int
+	Size   int
+	Align  int
+}
+
+// Layout is the estimated layout of a C struct generated by nanopb
+type Layout struct {
+	CTypeName string
+	Members   []*Member
+	Size      int
+	Align     int
+	// MaxEncodedSize is the nanopb <msg>_size define, only known once the layout is probed
+	MaxEncodedSize *int `json:",omitempty"`
+}
+
+// LayoutOptions describe the target the struct layout is estimated for. Static nanopb structs hold no pointers, so
+// only the alignment of 64-bit members differs between the usual targets.
+type LayoutOptions struct {
+	// Int64Align is the alignment of 64-bit integers and doubles within a struct, which is 4 on 32-bit x86
+	Int64Align int
+	// PbSizeTSize is sizeof(pb_size_t), which depends on PB_FIELD_32BIT
+	PbSizeTSize int
+}
+
+// NewLayoutOptions returns the layout options for the preprocessor definitions and target of the compiler options.
+// The target is taken from --target, or from the prefix of a cross compiler such as i686-linux-gnu-gcc, and is the
+// host otherwise. The layout is only an estimate, ProbeLayouts measures it with the compiler.
+func NewLayoutOptions(compilerOpts *CompilerOptions) *LayoutOptions {
+	opts := &LayoutOptions{Int64Align: int64Align(compilerOpts.targetTriple()), PbSizeTSize: 2}
+	for _, d := range compilerOpts.Defines() {
+		if name, _, _ := strings.Cut(d, "="); name == pbField32BitDefine {
+			opts.PbSizeTSize = 4
+		}
+	}
+	return opts
+}
+
+// int64Align returns the alignment of 64-bit members for a target triple, or for the host if it is empty
+func int64Align(triple string) int {
+	if len(triple) == 0 {
+		if runtime.GOARCH == "386" && runtime.GOOS != "windows" {
+			return 4
+		}
+		return 8
+	}
+	arch, rest, _ := strings.Cut(triple, "-")
+	switch arch {
+	case "i386", "i486", "i586", "i686", "x86":
+		for _, sys := range []string{"windows", "mingw", "cygwin", "msvc"} {
+			if strings.Contains(rest, sys) {
+				return 8
+			}
+		}
+		return 4
+	}
+	return 8
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// targetTriple returns the target triple set with --target, or the prefix of a cross compiler named after its triple
+func (o *CompilerOptions) targetTriple() string {
+	if o == nil {
+		return ""
+	}
+	if len(o.target) > 0 {
+		return o.target
+	}
+	cc := filepath.Base(o.CC())
+	if i := strings.LastIndex(cc, "-"); i > 0 && len(strings.Trim(cc[i+1:], "0123456789.")) == 0 {
+		// versioned compiler, e.g. aarch64-linux-gnu-gcc-12
+		cc = cc[:i]
+	}
+	if triple, name, ok := cutLast(cc, "-"); ok && strings.Contains(triple, "-") {
+		switch name {
+		case "gcc", "cc", "clang":
+			return triple
+		}
+	}
+	return ""
+}
+
+type cType struct {
+	name  string
+	size  int
+	align int
+}
+
+func alignUp(n, align int) int {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
+
+// ForEnum returns the options which apply to an enum
+func (o *Options) ForEnum(ed protoreflect.EnumDescriptor) *ResolvedOptions {
+	var parent *ResolvedOptions
+	names := []string{string(ed.Name())}
+	if pmd, ok := ed.Parent().(protoreflect.MessageDescriptor); ok {
+		parent = o.ForMessage(pmd)
+		names = append(messageNames(pmd), names...)
+	} else {
+		parent = o.ForFile(ed.ParentFile())
+		names = append(packageNames(ed.ParentFile()), names...)
+	}
+	return o.merge(parent, strings.Join(names, "."), ed.Options())
+}
+
+func (o *Options) enumCType(ed protoreflect.EnumDescriptor) cType {
+	names := []string{string(ed.Name())}
+	if pmd, ok := ed.Parent().(protoreflect.MessageDescriptor); ok {
+		names = append([]string{o.CTypeName(pmd)}, names...)
+	} else if pkg := packageNames(ed.ParentFile()); len(pkg) > 0 && o.ForFile(ed.ParentFile()).MangleNames() == ManglingNone {
+		names = append(pkg, names...)
+	}
+	ct := cType{name: strings.Join(names, "_"), size: 4, align: 4}
+
+	if o.ForEnum(ed).PackedEnum() {
+		lo, hi := int64(0), int64(0)
+		for i := 0; i < ed.Values().Len(); i++ {
+			n := int64(ed.Values().Get(i).Number())
+			lo, hi = min(lo, n), max(hi, n)
+		}
+		switch {
+		case lo >= -128 && hi <= 127, lo >= 0 && hi <= 255:
+			ct.size = 1
+		case lo >= -32768 && hi <= 32767, lo >= 0 && hi <= 65535:
+			ct.size = 2
+		}
+		ct.align = 1
+	}
+	return ct
+}
+
+func intCType(bits int32, signed bool, defaultBits int, lopts *LayoutOptions) cType {
+	if bits == 0 {
+		bits = int32(defaultBits)
+	}
+	name := fmt.Sprintf("uint%d_t", bits)
+	if signed {
+		name = fmt.Sprintf("int%d_t", bits)
+	}
+	return cType{name: name, size: int(bits / 8), align: min(int(bits/8), lopts.Int64Align)}
+}
+
+// valueCType returns the C type of a single value of a static field
+func (o *Options) valueCType(fd protoreflect.FieldDescriptor, lopts *LayoutOptions, stack map[protoreflect.FullName]bool) (cType, error) {
+	opts := o.ForField(fd)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return cType{name: "bool", size: 1, align: 1}, nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind:
+		return intCType(opts.IntSize(), true, 32, lopts), nil
+	case protoreflect.Uint32Kind:
+		return intCType(opts.IntSize(), false, 32, lopts), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind:
+		return intCType(opts.IntSize(), true, 64, lopts), nil
+	case protoreflect.Uint64Kind:
+		return intCType(opts.IntSize(), false, 64, lopts), nil
+	case protoreflect.Sfixed32Kind:
+		return intCType(0, true, 32, lopts), nil
+	case protoreflect.Fixed32Kind:
+		return intCType(0, false, 32, lopts), nil
+	case protoreflect.Sfixed64Kind:
+		return intCType(0, true, 64, lopts), nil
+	case protoreflect.Fixed64Kind:
+		return intCType(0, false, 64, lopts), nil
+	case protoreflect.FloatKind:
+		return cType{name: "float", size: 4, align: 4}, nil
+	case protoreflect.DoubleKind:
+		return cType{name: "double", size: 8, align: lopts.Int64Align}, nil
+	case protoreflect.EnumKind:
+		return o.enumCType(fd.Enum()), nil
+	case protoreflect.StringKind:
+		maxSize, _ := opts.MaxSize()
+		if maxLength, ok := opts.MaxLength(); ok {
+			maxSize = maxLength + 1
+		}
+		return cType{name: fmt.Sprintf("char[%d]", maxSize), size: int(maxSize), align: 1}, nil
+	case protoreflect.BytesKind:
+		maxSize, _ := opts.MaxSize()
+		if opts.FixedLength() {
+			return cType{name: fmt.Sprintf("pb_byte_t[%d]", maxSize), size: int(maxSize), align: 1}, nil
+		}
+		return cType{
+			name:  fmt.Sprintf("PB_BYTES_ARRAY_T(%d)", maxSize),
+			size:  alignUp(lopts.PbSizeTSize+int(maxSize), lopts.PbSizeTSize),
+			align: lopts.PbSizeTSize,
+		}, nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if stack[fd.Message().FullName()] {
+			return cType{}, fmt.Errorf("recursive reference to %s cannot be a fixed-size struct", fd.Message().FullName())
+		}
+		sub, err := o.layout(fd.Message(), lopts, stack)
+		if err != nil {
+			return cType{}, err
+		}
+		return cType{name: sub.CTypeName, size: sub.Size, align: sub.Align}, nil
+	}
+	return cType{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
+
+// layoutItem is a field or oneof of a message, in the order nanopb generates them
+type layoutItem struct {
+	number protoreflect.FieldNumber
+	field  protoreflect.FieldDescriptor
+	oneof  protoreflect.OneofDescriptor
+	fields []protoreflect.FieldDescriptor
+}
+
+// Layout estimates the layout of the C struct nanopb generates for a message
+func (o *Options) Layout(md protoreflect.MessageDescriptor, lopts *LayoutOptions) (*Layout, error) {
+	return o.layout(md, lopts, map[protoreflect.FullName]bool{})
+}
+
+func (o *Options) layout(md protoreflect.MessageDescriptor, lopts *LayoutOptions, stack map[protoreflect.FullName]bool) (*Layout, error) {
+	stack[md.FullName()] = true
+	defer delete(stack, md.FullName())
+
+	msgOpts := o.ForMessage(md)
+	packed := msgOpts.PackedStruct()
+	l := &Layout{CTypeName: o.CTypeName(md), Members: make([]*Member, 0), Align: 1}
+
+	add := func(fd protoreflect.FieldDescriptor, name string, ct cType) {
+		align := ct.align
+		if packed {
+			align = 1
+		}
+		m := &Member{Field: fd, Name: name, CType: ct.name, Offset: alignUp(l.Size, align), Size: ct.size, Align: align}
+		l.Members = append(l.Members, m)
+		l.Size = m.Offset + m.Size
+		l.Align = max(l.Align, align)
+	}
+	pbSizeT := cType{name: "pb_size_t", size: lopts.PbSizeTSize, align: lopts.PbSizeTSize}
+	boolT := cType{name: "bool", size: 1, align: 1}
+
+	items := make([]*layoutItem, 0)
+	oneofs := make(map[protoreflect.FullName]*layoutItem)
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		t, err := o.Allocation(fd)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fd.FullName(), err)
+		}
+		switch t {
+		case FieldTypeIgnore:
+			continue
+		case FieldTypeStatic:
+		default:
+			return nil, fmt.Errorf("%s: %s", fd.FullName(), callbackReason(fd, t))
+		}
+
+		od := fd.ContainingOneof()
+		if od == nil || od.IsSynthetic() || msgOpts.NoUnions() {
+			items = append(items, &layoutItem{number: fd.Number(), field: fd})
+		} else if item, ok := oneofs[od.FullName()]; ok {
+			item.fields = append(item.fields, fd)
+			item.number = min(item.number, fd.Number())
+		} else {
+			oneofs[od.FullName()] = &layoutItem{number: fd.Number(), oneof: od, fields: []protoreflect.FieldDescriptor{fd}}
+			items = append(items, oneofs[od.FullName()])
+		}
+	}
+	if msgOpts.SortByTag() {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].number < items[j].number })
+	}
+
+	for _, item := range items {
+		if item.oneof != nil {
+			name := string(item.oneof.Name())
+			add(nil, "which_"+name, pbSizeT)
+
+			union := cType{name: "union", align: 1}
+			unionMembers := make([]*Member, 0, len(item.fields))
+			for _, fd := range item.fields {
+				ct, err := o.valueCType(fd, lopts, stack)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", fd.FullName(), err)
+				}
+				memberName := string(fd.Name())
+				if !msgOpts.AnonymousOneof() {
+					memberName = name + "." + memberName
+				}
+				unionMembers = append(unionMembers, &Member{Field: fd, Name: memberName, CType: ct.name, Size: ct.size, Align: ct.align})
+				union.size = max(union.size, ct.size)
+				union.align = max(union.align, ct.align)
+			}
+			union.size = alignUp(union.size, union.align)
+			add(nil, name, union)
+			unionOffset := l.Members[len(l.Members)-1].Offset
+			l.Members = l.Members[:len(l.Members)-1]
+			for _, m := range unionMembers {
+				m.Offset = unionOffset
+				l.Members = append(l.Members, m)
+			}
+			continue
+		}
+
+		fd := item.field
+		ct, err := o.valueCType(fd, lopts, stack)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fd.FullName(), err)
+		}
+		name := string(fd.Name())
+		fieldOpts := o.ForField(fd)
+
+		switch {
+		case fd.Cardinality() == protoreflect.Repeated:
+			maxCount, _ := fieldOpts.MaxCount()
+			if !fieldOpts.FixedCount() {
+				add(fd, name+"_count", pbSizeT)
+			}
+			add(fd, name, cType{name: fmt.Sprintf("%s[%d]", ct.name, maxCount), size: ct.size * int(maxCount), align: ct.align})
+		case fd.Cardinality() == protoreflect.Required:
+			add(fd, name, ct)
+		case fieldOpts.Proto3() && !fd.HasPresence():
+			add(fd, name, ct)
+		case fieldOpts.Proto3() && fd.Message() != nil && fieldOpts.Proto3SingularMsgs():
+			add(fd, name, ct)
+		default:
+			add(fd, "has_"+name, boolT)
+			add(fd, name, ct)
+		}
+	}
+
+	if len(l.Members) == 0 {
+		add(nil, "dummy_field", cType{name: "char", size: 1, align: 1})
+	}
+	l.Size = alignUp(l.Size, l.Align)
+	return l, nil
+}
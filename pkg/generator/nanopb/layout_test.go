@@ -0,0 +1,112 @@
+package nanopb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	snapshotDir = "../../__snapshots__"
+	testdataDir = "../../../testdata"
+)
+
+func loadExample(t *testing.T, example, protoPackageName string) protoreflect.FileDescriptor {
+	data, err := os.ReadFile(filepath.Join(snapshotDir, example, protoPackageName+".pb"))
+	require.NoError(t, err)
+	fds := &descriptorpb.FileDescriptorSet{}
+	require.NoError(t, proto.Unmarshal(data, fds))
+	files, err := protodesc.NewFiles(fds)
+	require.NoError(t, err)
+	fd, err := files.FindFileByPath(protoPackageName + ".proto")
+	require.NoError(t, err)
+	return fd
+}
+
+func TestLayout(t *testing.T) {
+	testCases := []struct {
+		example          string
+		protoPackageName string
+		sizes            map[protoreflect.Name]int
+	}{
+		{"example1", "example", map[protoreflect.Name]int{"my_struct": 12, "request": 44, "response": 104, "req_resp": 108, "status": 116}},
+		{"example2", "example2", map[protoreflect.Name]int{"item": 36}},
+		{"example3", "example3", map[protoreflect.Name]int{"obj": 880}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.example, func(t *testing.T) {
+			fd := loadExample(t, tc.example, tc.protoPackageName)
+			opts, err := LoadOptionsForProto(filepath.Join(testdataDir, tc.example, tc.protoPackageName+".proto"))
+			require.NoError(t, err)
+
+			for name, size := range tc.sizes {
+				md := fd.Messages().ByName(name)
+				require.NotNil(t, md)
+				assert.Empty(t, opts.CheckMessage(md))
+				layout, err := opts.Layout(md, NewLayoutOptions(&CompilerOptions{defines: []string{"PB_FIELD_32BIT=1"}, target: "x86_64-linux-gnu"}))
+				require.NoError(t, err)
+				assert.Equal(t, size, layout.Size, "size of %s", name)
+				assert.Equal(t, string(name), layout.CTypeName)
+			}
+		})
+	}
+}
+
+func TestLayoutForTarget(t *testing.T) {
+	fd := loadExample(t, "example3", "example3")
+	opts, err := LoadOptionsForProto(filepath.Join(testdataDir, "example3", "example3.proto"))
+	require.NoError(t, err)
+	md := fd.Messages().ByName("obj")
+
+	testCases := []struct {
+		name         string
+		compilerOpts *CompilerOptions
+		int64Align   int
+		size         int
+	}{
+		{"x86_64", &CompilerOptions{target: "x86_64-linux-gnu"}, 8, 880},
+		{"aarch64 cross compiler", &CompilerOptions{cc: "/usr/bin/aarch64-linux-gnu-gcc-12"}, 8, 880},
+		{"i686", &CompilerOptions{target: "i686-linux-gnu"}, 4, 856},
+		{"i686 cross compiler", &CompilerOptions{cc: "i686-linux-gnu-gcc"}, 4, 856},
+		{"i686 windows", &CompilerOptions{target: "i686-w64-mingw32"}, 8, 880},
+		{"armv7", &CompilerOptions{target: "armv7-linux-gnueabihf"}, 8, 880},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envVarPbField32Bit, "1")
+			lopts := NewLayoutOptions(tc.compilerOpts)
+			assert.Equal(t, tc.int64Align, lopts.Int64Align)
+			layout, err := opts.Layout(md, lopts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.size, layout.Size)
+		})
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	fd := loadExample(t, "example1", "example")
+	opts, err := ParseOptions([]byte("# only request is constrained\nrequest.name max_size:32 /* inline comment */\n"))
+	require.NoError(t, err)
+
+	assert.Empty(t, opts.CheckMessage(fd.Messages().ByName("request")))
+
+	issues := opts.CheckMessage(fd.Messages().ByName("req_resp"))
+	require.Len(t, issues, 1)
+	assert.Equal(t, protoreflect.FullName("response.msg"), issues[0].Name)
+
+	opts, err = ParseOptions([]byte("*.name type:FT_POINTER\n*.msg max_size:10\nstatus.status max_length:9\n"))
+	require.NoError(t, err)
+	issues = opts.CheckMessage(fd.Messages().ByName("request"))
+	require.Len(t, issues, 1)
+	assert.Equal(t, protoreflect.FullName("request.name"), issues[0].Name)
+	assert.Empty(t, opts.CheckMessage(fd.Messages().ByName("status")))
+}
@@ -13,8 +13,6 @@ const (
 var (
 	// GeneratorPath is $NANO_PB/generator/nanopb_generator
 	GeneratorPath string
-	// ProtocPath is $NANO_PB/generator/protoc
-	ProtocPath string
 	// Path is $NANO_PB
 	Path string
 	// PbCommonCPath is $NANO_PB/pb_common.c
@@ -32,7 +30,6 @@ func init() {
 		log.Fatal(err)
 	}
 
-	ProtocPath = fmt.Sprintf("%s/generator/protoc", Path)
 	GeneratorPath = fmt.Sprintf("%s/generator/nanopb_generator", Path)
 	PbCommonCPath = fmt.Sprintf("%s/pb_common.c", Path)
 	PbDecodeCPath = fmt.Sprintf("%s/pb_decode.c", Path)
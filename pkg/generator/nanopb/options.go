@@ -0,0 +1,395 @@
+package nanopb
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// nanopbExtensionNumber is the extension number nanopb uses for its options on
+	// google.protobuf.{File,Message,Enum,Field}Options
+	nanopbExtensionNumber = protowire.Number(1010)
+	optionsExtension      = ".options"
+)
+
+// FieldType is the nanopb allocation type of a field
+type FieldType int32
+
+// Allocation types, as defined in nanopb.proto
+const (
+	FieldTypeDefault  FieldType = 0
+	FieldTypeCallback FieldType = 1
+	FieldTypeStatic   FieldType = 2
+	FieldTypeIgnore   FieldType = 3
+	FieldTypePointer  FieldType = 4
+	FieldTypeInline   FieldType = 5
+)
+
+// TypenameMangling is the nanopb type name mangling mode
+type TypenameMangling int32
+
+// Type name mangling modes, as defined in nanopb.proto
+const (
+	ManglingNone            TypenameMangling = 0
+	ManglingStripPackage    TypenameMangling = 1
+	ManglingFlatten         TypenameMangling = 2
+	ManglingPackageInitials TypenameMangling = 3
+)
+
+var (
+	commentBlockRegexp = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	commentLineRegexp  = regexp.MustCompile(`(?m)(//|#).*$`)
+
+	optionsDesc protoreflect.MessageDescriptor
+)
+
+func init() {
+	var err error
+	optionsDesc, err = newOptionsDescriptor()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newOptionsDescriptor builds the subset of nanopb.proto's NanoPBOptions which is relevant to struct generation
+func newOptionsDescriptor() (protoreflect.MessageDescriptor, error) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	field := func(name string, number int32, label *descriptorpb.FieldDescriptorProto_Label, t descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  label,
+			Type:   t.Enum(),
+		}
+		if len(typeName) > 0 {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	enum := func(name string, values map[string]int32, order ...string) *descriptorpb.EnumDescriptorProto {
+		e := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+		for _, v := range order {
+			e.Value = append(e.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(v), Number: proto.Int32(values[v])})
+		}
+		return e
+	}
+	tBool := descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	tEnum := descriptorpb.FieldDescriptorProto_TYPE_ENUM
+	tInt32 := descriptorpb.FieldDescriptorProto_TYPE_INT32
+	tString := descriptorpb.FieldDescriptorProto_TYPE_STRING
+	tUint32 := descriptorpb.FieldDescriptorProto_TYPE_UINT32
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("jbpf_nanopb_options.proto"),
+		Package:    proto.String("jbpf_nanopb"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Syntax:     proto.String("proto2"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{
+			enum("FieldType", map[string]int32{"FT_DEFAULT": 0, "FT_CALLBACK": 1, "FT_STATIC": 2, "FT_IGNORE": 3, "FT_POINTER": 4, "FT_INLINE": 5},
+				"FT_DEFAULT", "FT_CALLBACK", "FT_STATIC", "FT_IGNORE", "FT_POINTER", "FT_INLINE"),
+			enum("IntSize", map[string]int32{"IS_DEFAULT": 0, "IS_8": 8, "IS_16": 16, "IS_32": 32, "IS_64": 64},
+				"IS_DEFAULT", "IS_8", "IS_16", "IS_32", "IS_64"),
+			enum("TypenameMangling", map[string]int32{"M_NONE": 0, "M_STRIP_PACKAGE": 1, "M_FLATTEN": 2, "M_PACKAGE_INITIALS": 3},
+				"M_NONE", "M_STRIP_PACKAGE", "M_FLATTEN", "M_PACKAGE_INITIALS"),
+			enum("DescriptorSize", map[string]int32{"DS_AUTO": 0, "DS_1": 1, "DS_2": 2, "DS_4": 4, "DS_8": 8},
+				"DS_AUTO", "DS_1", "DS_2", "DS_4", "DS_8"),
+		},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("NanoPBOptions"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("max_size", 1, optional, tInt32, ""),
+				field("max_count", 2, optional, tInt32, ""),
+				field("type", 3, optional, tEnum, ".jbpf_nanopb.FieldType"),
+				field("long_names", 4, optional, tBool, ""),
+				field("packed_struct", 5, optional, tBool, ""),
+				field("skip_message", 6, optional, tBool, ""),
+				field("int_size", 7, optional, tEnum, ".jbpf_nanopb.IntSize"),
+				field("no_unions", 8, optional, tBool, ""),
+				field("msgid", 9, optional, tUint32, ""),
+				field("packed_enum", 10, optional, tBool, ""),
+				field("anonymous_oneof", 11, optional, tBool, ""),
+				field("proto3", 12, optional, tBool, ""),
+				field("enum_to_string", 13, optional, tBool, ""),
+				field("max_length", 14, optional, tInt32, ""),
+				field("fixed_length", 15, optional, tBool, ""),
+				field("fixed_count", 16, optional, tBool, ""),
+				field("mangle_names", 17, optional, tEnum, ".jbpf_nanopb.TypenameMangling"),
+				field("callback_datatype", 18, optional, tString, ""),
+				field("callback_function", 19, optional, tString, ""),
+				field("descriptorsize", 20, optional, tEnum, ".jbpf_nanopb.DescriptorSize"),
+				field("proto3_singular_msgs", 21, optional, tBool, ""),
+				field("submsg_callback", 22, optional, tBool, ""),
+				field("default_has", 23, optional, tBool, ""),
+				field("include", 24, repeated, tString, ""),
+				field("package", 25, optional, tString, ""),
+				field("exclude", 26, repeated, tString, ""),
+				field("type_override", 27, optional, tEnum, ".google.protobuf.FieldDescriptorProto.Type"),
+				field("sort_by_tag", 28, optional, tBool, ""),
+				field("fallback_type", 29, optional, tEnum, ".jbpf_nanopb.FieldType"),
+			},
+		}},
+	}
+
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		return nil, err
+	}
+	return fd.Messages().ByName("NanoPBOptions"), nil
+}
+
+type optionsEntry struct {
+	pattern string
+	options *dynamicpb.Message
+}
+
+// Options are the nanopb generator options defined in a .options file
+type Options struct {
+	entries []*optionsEntry
+}
+
+// ParseOptions parses the content of a nanopb .options file
+func ParseOptions(data []byte) (*Options, error) {
+	content := commentBlockRegexp.ReplaceAllString(string(data), "")
+	content = commentLineRegexp.ReplaceAllString(content, "")
+
+	opts := &Options{entries: make([]*optionsEntry, 0)}
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		idx := strings.IndexAny(line, " \t")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected a name pattern followed by options", i+1)
+		}
+		parts := []string{line[:idx], line[idx+1:]}
+
+		msg := dynamicpb.NewMessage(optionsDesc)
+		if err := (prototext.UnmarshalOptions{DiscardUnknown: true}).Unmarshal([]byte(parts[1]), msg); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		opts.entries = append(opts.entries, &optionsEntry{
+			pattern: strings.ReplaceAll(parts[0], "[!", "[^"),
+			options: msg,
+		})
+	}
+	return opts, nil
+}
+
+// LoadOptionsForProto loads the .options file which nanopb uses alongside a .proto file, if one exists
+func LoadOptionsForProto(protoPath string) (*Options, error) {
+	optionsPath := strings.TrimSuffix(protoPath, path.Ext(protoPath)) + optionsExtension
+	data, err := os.ReadFile(optionsPath)
+	if os.IsNotExist(err) {
+		return &Options{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	opts, err := ParseOptions(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", optionsPath, err)
+	}
+	return opts, nil
+}
+
+// ResolvedOptions are the nanopb options which apply to a file, message or field
+type ResolvedOptions struct {
+	msg *dynamicpb.Message
+}
+
+func (r *ResolvedOptions) int32Field(name protoreflect.Name) (int32, bool) {
+	fd := optionsDesc.Fields().ByName(name)
+	if !r.msg.Has(fd) {
+		return 0, false
+	}
+	return int32(r.msg.Get(fd).Int()), true
+}
+
+func (r *ResolvedOptions) boolField(name protoreflect.Name) bool {
+	return r.msg.Get(optionsDesc.Fields().ByName(name)).Bool()
+}
+
+func (r *ResolvedOptions) enumField(name protoreflect.Name) int32 {
+	return int32(r.msg.Get(optionsDesc.Fields().ByName(name)).Enum())
+}
+
+// MaxSize returns the max_size option, if set
+func (r *ResolvedOptions) MaxSize() (int32, bool) { return r.int32Field("max_size") }
+
+// MaxLength returns the max_length option, if set
+func (r *ResolvedOptions) MaxLength() (int32, bool) { return r.int32Field("max_length") }
+
+// MaxCount returns the max_count option, if set
+func (r *ResolvedOptions) MaxCount() (int32, bool) { return r.int32Field("max_count") }
+
+// IntSize returns the int_size option in bits, 0 being the default size
+func (r *ResolvedOptions) IntSize() int32 { return r.enumField("int_size") }
+
+// Type returns the allocation type option
+func (r *ResolvedOptions) Type() FieldType { return FieldType(r.enumField("type")) }
+
+// FallbackType returns the allocation type used when a field cannot be static
+func (r *ResolvedOptions) FallbackType() FieldType {
+	fd := optionsDesc.Fields().ByName("fallback_type")
+	if !r.msg.Has(fd) {
+		return FieldTypeCallback
+	}
+	return FieldType(r.msg.Get(fd).Enum())
+}
+
+// FixedLength returns the fixed_length option
+func (r *ResolvedOptions) FixedLength() bool { return r.boolField("fixed_length") }
+
+// FixedCount returns the fixed_count option
+func (r *ResolvedOptions) FixedCount() bool { return r.boolField("fixed_count") }
+
+// SkipMessage returns the skip_message option
+func (r *ResolvedOptions) SkipMessage() bool { return r.boolField("skip_message") }
+
+// PackedStruct returns the packed_struct option
+func (r *ResolvedOptions) PackedStruct() bool { return r.boolField("packed_struct") }
+
+// PackedEnum returns the packed_enum option
+func (r *ResolvedOptions) PackedEnum() bool { return r.boolField("packed_enum") }
+
+// NoUnions returns the no_unions option
+func (r *ResolvedOptions) NoUnions() bool { return r.boolField("no_unions") }
+
+// AnonymousOneof returns the anonymous_oneof option
+func (r *ResolvedOptions) AnonymousOneof() bool { return r.boolField("anonymous_oneof") }
+
+// Proto3 returns whether proto3 semantics apply
+func (r *ResolvedOptions) Proto3() bool { return r.boolField("proto3") }
+
+// Proto3SingularMsgs returns the proto3_singular_msgs option
+func (r *ResolvedOptions) Proto3SingularMsgs() bool { return r.boolField("proto3_singular_msgs") }
+
+// SortByTag returns the sort_by_tag option, which defaults to true
+func (r *ResolvedOptions) SortByTag() bool {
+	fd := optionsDesc.Fields().ByName("sort_by_tag")
+	if !r.msg.Has(fd) {
+		return true
+	}
+	return r.msg.Get(fd).Bool()
+}
+
+// MangleNames returns the mangle_names option
+func (r *ResolvedOptions) MangleNames() TypenameMangling {
+	return TypenameMangling(r.enumField("mangle_names"))
+}
+
+// merge derives new options from r, following the same precedence as the nanopb generator:
+// inherited options, then matching entries from the .options file, then options defined in the .proto file
+func (o *Options) merge(r *ResolvedOptions, name string, descOptions proto.Message) *ResolvedOptions {
+	msg := dynamicpb.NewMessage(optionsDesc)
+	if r != nil {
+		proto.Merge(msg, r.msg)
+	}
+	if o != nil {
+		for _, e := range o.entries {
+			if ok, err := path.Match(e.pattern, name); err == nil && ok {
+				proto.Merge(msg, e.options)
+			}
+		}
+	}
+	if descOptions != nil && descOptions.ProtoReflect().IsValid() {
+		unknown := descOptions.ProtoReflect().GetUnknown()
+		for len(unknown) > 0 {
+			num, typ, n := protowire.ConsumeTag(unknown)
+			if n < 0 {
+				break
+			}
+			unknown = unknown[n:]
+			m := protowire.ConsumeFieldValue(num, typ, unknown)
+			if m < 0 {
+				break
+			}
+			if num == nanopbExtensionNumber && typ == protowire.BytesType {
+				if bs, k := protowire.ConsumeBytes(unknown[:m]); k >= 0 {
+					_ = proto.UnmarshalOptions{Merge: true, DiscardUnknown: true}.Unmarshal(bs, msg)
+				}
+			}
+			unknown = unknown[m:]
+		}
+	}
+	return &ResolvedOptions{msg: msg}
+}
+
+func packageNames(fd protoreflect.FileDescriptor) []string {
+	if len(fd.Package()) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(fd.Package()), ".")
+}
+
+// messageNames returns the nanopb names of a message, starting with the package components
+func messageNames(md protoreflect.MessageDescriptor) []string {
+	names := []string{string(md.Name())}
+	for parent := md.Parent(); parent != nil; parent = parent.Parent() {
+		if pmd, ok := parent.(protoreflect.MessageDescriptor); ok {
+			names = append([]string{string(pmd.Name())}, names...)
+		}
+	}
+	return append(packageNames(md.ParentFile()), names...)
+}
+
+// ForFile returns the options which apply to a file
+func (o *Options) ForFile(fd protoreflect.FileDescriptor) *ResolvedOptions {
+	r := &ResolvedOptions{msg: dynamicpb.NewMessage(optionsDesc)}
+	if fd.Syntax() == protoreflect.Proto3 {
+		r.msg.Set(optionsDesc.Fields().ByName("proto3"), protoreflect.ValueOfBool(true))
+	}
+	return o.merge(r, fd.Path(), fd.Options())
+}
+
+// ForMessage returns the options which apply to a message
+func (o *Options) ForMessage(md protoreflect.MessageDescriptor) *ResolvedOptions {
+	var parent *ResolvedOptions
+	if pmd, ok := md.Parent().(protoreflect.MessageDescriptor); ok {
+		parent = o.ForMessage(pmd)
+	} else {
+		parent = o.ForFile(md.ParentFile())
+	}
+	return o.merge(parent, strings.Join(messageNames(md), "."), md.Options())
+}
+
+// ForField returns the options which apply to a field
+func (o *Options) ForField(fd protoreflect.FieldDescriptor) *ResolvedOptions {
+	md := fd.ContainingMessage()
+	return o.merge(o.ForMessage(md), strings.Join(append(messageNames(md), string(fd.Name())), "."), fd.Options())
+}
+
+// CTypeName returns the name of the C struct nanopb generates for a message
+func (o *Options) CTypeName(md protoreflect.MessageDescriptor) string {
+	names := messageNames(md)
+	pkgNames := packageNames(md.ParentFile())
+	switch o.ForFile(md.ParentFile()).MangleNames() {
+	case ManglingStripPackage:
+		names = names[len(pkgNames):]
+	case ManglingFlatten:
+		names = []string{string(md.Name())}
+	case ManglingPackageInitials:
+		initials := ""
+		for _, p := range pkgNames {
+			if len(p) > 0 {
+				initials += p[:1]
+			}
+		}
+		names = append([]string{initials}, names[len(pkgNames):]...)
+	}
+	return strings.Join(names, "_")
+}
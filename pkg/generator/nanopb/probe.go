@@ -0,0 +1,145 @@
+package nanopb
+
+import (
+	"context"
+	"debug/elf"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	probeC        = "jbpf_layout_probe.c"
+	probeO        = "jbpf_layout_probe.o"
+	probeSymbol   = "jbpf_layout_probe_%d_%s"
+	probeNoSize   = "-1"
+	probeSymMax   = "max"
+	probeSymSize  = "size"
+	probeSymAlign = "align"
+)
+
+func probeMemberSymbol(kind string, i int) string {
+	return fmt.Sprintf("%s%d", kind, i)
+}
+
+// ProbeLayouts measures the actual layout of nanopb structs by compiling a probe object against the generated header.
+// The estimated sizes and offsets of the layouts are replaced by those of the compiler. As the probe is only compiled
+// and never run, it can be used when cross compiling.
+func ProbeLayouts(ctx context.Context, logger *logrus.Logger, compilerOpts *CompilerOptions, header string, layouts []*Layout) error {
+	var src strings.Builder
+	src.WriteString("#include <stddef.h>\n#include <stdint.h>\n")
+	fmt.Fprintf(&src, "#include \"%s\"\n\n", header)
+
+	for i, l := range layouts {
+		fmt.Fprintf(&src, "const int64_t "+probeSymbol+" = sizeof(%s);\n", i, probeSymSize, l.CTypeName)
+		fmt.Fprintf(&src, "const int64_t "+probeSymbol+" = _Alignof(%s);\n", i, probeSymAlign, l.CTypeName)
+		fmt.Fprintf(&src, "#ifdef %s_size\nconst int64_t "+probeSymbol+" = %s_size;\n#else\nconst int64_t "+probeSymbol+" = %s;\n#endif\n",
+			l.CTypeName, i, probeSymMax, l.CTypeName, i, probeSymMax, probeNoSize)
+		for j, m := range l.Members {
+			fmt.Fprintf(&src, "const int64_t "+probeSymbol+" = offsetof(%s, %s);\n", i, probeMemberSymbol("offset", j), l.CTypeName, m.Name)
+			fmt.Fprintf(&src, "const int64_t "+probeSymbol+" = sizeof(((%s*)0)->%s);\n", i, probeMemberSymbol("size", j), l.CTypeName, m.Name)
+			fmt.Fprintf(&src, "const int64_t "+probeSymbol+" = _Alignof(__typeof__(((%s*)0)->%s));\n", i, probeMemberSymbol("align", j), l.CTypeName, m.Name)
+		}
+	}
+
+	if err := os.WriteFile(probeC, []byte(src.String()), 0644); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.Remove(probeO); err != nil && !os.IsNotExist(err) {
+			logger.WithError(err).Warn("failed to remove probe")
+		}
+		if err := os.Remove(probeC); err != nil {
+			logger.WithError(err).Warn("failed to remove probe source")
+		}
+	}()
+
+	args := append(compilerOpts.CompileArgs(), "-c", probeC, "-o", probeO)
+	if err := common.RunSubprocess(ctx, logger, compilerOpts.CC(), args...); err != nil {
+		return err
+	}
+
+	values, err := readProbeValues(probeO)
+	if err != nil {
+		return err
+	}
+
+	lookup := func(i int, kind string) (int, error) {
+		name := fmt.Sprintf(probeSymbol, i, kind)
+		v, ok := values[name]
+		if !ok {
+			return 0, fmt.Errorf("symbol %s not found in probe", name)
+		}
+		return int(v), nil
+	}
+
+	for i, l := range layouts {
+		var errs [3]error
+		l.Size, errs[0] = lookup(i, probeSymSize)
+		l.Align, errs[1] = lookup(i, probeSymAlign)
+		var maxSize int
+		maxSize, errs[2] = lookup(i, probeSymMax)
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		if maxSize >= 0 {
+			l.MaxEncodedSize = &maxSize
+		}
+
+		for j, m := range l.Members {
+			if m.Offset, err = lookup(i, probeMemberSymbol("offset", j)); err != nil {
+				return err
+			}
+			if m.Size, err = lookup(i, probeMemberSymbol("size", j)); err != nil {
+				return err
+			}
+			if m.Align, err = lookup(i, probeMemberSymbol("align", j)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readProbeValues reads the values of the int64 probe symbols from an ELF object
+func readProbeValues(path string) (map[string]int64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	symbols, err := f.Symbols()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int64)
+	for _, sym := range symbols {
+		if !strings.HasPrefix(sym.Name, "jbpf_layout_probe_") || sym.Size != 8 || int(sym.Section) >= len(f.Sections) {
+			continue
+		}
+		sec := f.Sections[sym.Section]
+		if sec.Type == elf.SHT_NOBITS {
+			values[sym.Name] = 0
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		offset := sym.Value - sec.Addr
+		if offset+8 > uint64(len(data)) {
+			return nil, fmt.Errorf("symbol %s is out of range of section %s", sym.Name, sec.Name)
+		}
+		values[sym.Name] = int64(f.ByteOrder.Uint64(data[offset : offset+8]))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,92 @@
+package nanopb
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireCC(t *testing.T) {
+	if _, err := exec.LookPath(defaultCC); err != nil {
+		t.Skip("no host C compiler")
+	}
+}
+
+// inTempDir runs the test in a temporary directory, as the probe is written to the working directory
+func inTempDir(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { require.NoError(t, os.Chdir(wd)) })
+}
+
+func TestReadProbeValues(t *testing.T) {
+	requireCC(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, probeC)
+	require.NoError(t, os.WriteFile(src, []byte("#include <stdint.h>\n"+
+		"const int64_t jbpf_layout_probe_0_size = 116;\n"+
+		"const int64_t jbpf_layout_probe_0_max = -1;\n"+
+		"int64_t jbpf_layout_probe_0_offset0;\n"+
+		"const int32_t jbpf_layout_probe_0_align = 4;\n"+
+		"const int64_t other = 1;\n"), 0644))
+	obj := filepath.Join(dir, probeO)
+	out, err := exec.Command(defaultCC, "-c", src, "-o", obj).CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	values, err := readProbeValues(obj)
+	require.NoError(t, err)
+	// symbols which are not int64 probes are ignored
+	assert.Equal(t, map[string]int64{
+		"jbpf_layout_probe_0_size":    116,
+		"jbpf_layout_probe_0_max":     -1,
+		"jbpf_layout_probe_0_offset0": 0,
+	}, values)
+}
+
+func TestProbeLayouts(t *testing.T) {
+	if Path == "" {
+		t.Skip(`"NANO_PB" not set`)
+	}
+	requireCC(t)
+
+	fd := loadExample(t, "example1", "example")
+	opts, err := LoadOptionsForProto(filepath.Join(testdataDir, "example1", "example.proto"))
+	require.NoError(t, err)
+	header, err := os.ReadFile(filepath.Join(snapshotDir, "example1", "example.pb.h"))
+	require.NoError(t, err)
+
+	compilerOpts := &CompilerOptions{}
+	layout, err := opts.Layout(fd.Messages().ByName("status"), NewLayoutOptions(compilerOpts))
+	require.NoError(t, err)
+	// clear the estimate, so every value checked below is measured
+	layout.Size, layout.Align = 0, 0
+	for _, m := range layout.Members {
+		m.Offset, m.Size, m.Align = 0, 0, 0
+	}
+
+	inTempDir(t)
+	require.NoError(t, os.WriteFile("example.pb.h", header, 0644))
+	require.NoError(t, ProbeLayouts(context.Background(), logrus.New(), compilerOpts, "example.pb.h", []*Layout{layout}))
+
+	assert.Equal(t, 116, layout.Size)
+	assert.Equal(t, 4, layout.Align)
+	require.NotNil(t, layout.MaxEncodedSize)
+	assert.Equal(t, 121, *layout.MaxEncodedSize)
+	members := make(map[string]*Member)
+	for _, m := range layout.Members {
+		members[m.Name] = m
+	}
+	require.Contains(t, members, "a_struct")
+	assert.Equal(t, 104, members["a_struct"].Offset)
+	assert.Equal(t, 12, members["a_struct"].Size)
+	assert.NoFileExists(t, probeC)
+	assert.NoFileExists(t, probeO)
+}
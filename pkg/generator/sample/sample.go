@@ -0,0 +1,251 @@
+package sample
+
+import (
+	"jbpf_protobuf_cli/generator/nanopb"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// defaultMaxCount is the number of elements generated for a repeated field without max_count
+	defaultMaxCount = 4
+	// defaultMaxSize is the length of strings and bytes generated for a field without max_size
+	defaultMaxSize = 16
+	floatRange     = 1000
+	stringAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Options are the options for generating sample messages
+type Options struct {
+	random bool
+	seed   int64
+
+	rng *rand.Rand
+}
+
+// AddOptionsToFlags adds the options to the provided flag set
+func AddOptionsToFlags(flags *pflag.FlagSet, opts *Options) {
+	if opts == nil {
+		return
+	}
+
+	flags.BoolVar(&opts.random, "random", false, "fill fields with random values which respect the max_size, max_count and int_size options, instead of a skeleton of zero values")
+	flags.Int64Var(&opts.seed, "seed", 0, "seed for --random, a seed is chosen from the current time when 0")
+}
+
+// Parse the options
+func (o *Options) Parse() error {
+	if o.random && o.seed == 0 {
+		o.seed = time.Now().UnixNano()
+	}
+	o.rng = rand.New(rand.NewPCG(uint64(o.seed), uint64(o.seed)))
+	return nil
+}
+
+// Random returns true if random values are generated
+func (o *Options) Random() bool {
+	return o.random
+}
+
+// Seed returns the seed random values are generated from
+func (o *Options) Seed() int64 {
+	return o.seed
+}
+
+type generator struct {
+	nanopbOpts *nanopb.Options
+	random     bool
+	rng        *rand.Rand
+	stack      map[protoreflect.FullName]bool
+}
+
+// Generate returns a sample of a message. By default every field is set to its zero value and repeated fields have a
+// single element, so the JSON form acts as a skeleton. With --random, fields are set to random values which fit in the
+// struct nanopb generates for the message. Recursive message fields are left unset.
+func Generate(opts *Options, nanopbOpts *nanopb.Options, md protoreflect.MessageDescriptor) *dynamicpb.Message {
+	g := &generator{
+		nanopbOpts: nanopbOpts,
+		random:     opts.random,
+		rng:        opts.rng,
+		stack:      make(map[protoreflect.FullName]bool),
+	}
+	return g.message(md)
+}
+
+// Marshal returns the JSON form of a sample, including unpopulated fields
+func Marshal(msg proto.Message) ([]byte, error) {
+	return protojson.MarshalOptions{
+		EmitUnpopulated: true,
+		Indent:          "  ",
+		Multiline:       true,
+	}.Marshal(msg)
+}
+
+func (g *generator) message(md protoreflect.MessageDescriptor) *dynamicpb.Message {
+	g.stack[md.FullName()] = true
+	defer delete(g.stack, md.FullName())
+
+	msg := dynamicpb.NewMessage(md)
+	oneofs := make(map[protoreflect.FullName]protoreflect.FieldDescriptor)
+	for i := 0; i < md.Oneofs().Len(); i++ {
+		od := md.Oneofs().Get(i)
+		if od.IsSynthetic() {
+			continue
+		}
+		chosen := 0
+		if g.random {
+			chosen = g.rng.IntN(od.Fields().Len())
+		}
+		oneofs[od.FullName()] = od.Fields().Get(chosen)
+	}
+
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		if t, err := g.nanopbOpts.Allocation(fd); err == nil && t == nanopb.FieldTypeIgnore {
+			continue
+		}
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() && oneofs[od.FullName()] != fd {
+			continue
+		}
+		if fd.Message() != nil && !fd.IsMap() && g.stack[fd.Message().FullName()] {
+			continue
+		}
+
+		switch {
+		case fd.IsMap():
+			m := msg.Mutable(fd).Map()
+			for n := g.count(fd); n > 0; n-- {
+				m.Set(g.value(fd.MapKey()).MapKey(), g.value(fd.MapValue()))
+			}
+		case fd.IsList():
+			l := msg.Mutable(fd).List()
+			for n := g.count(fd); n > 0; n-- {
+				l.Append(g.value(fd))
+			}
+		default:
+			msg.Set(fd, g.value(fd))
+		}
+	}
+
+	return msg
+}
+
+// count returns the number of elements to generate for a repeated field
+func (g *generator) count(fd protoreflect.FieldDescriptor) int {
+	opts := g.nanopbOpts.ForField(fd)
+	maxCount, ok := opts.MaxCount()
+	if !ok {
+		maxCount = defaultMaxCount
+	}
+	switch {
+	case opts.FixedCount():
+		return int(maxCount)
+	case !g.random:
+		return min(1, int(maxCount))
+	default:
+		return g.rng.IntN(int(maxCount) + 1)
+	}
+}
+
+// length returns the length of a string or bytes field
+func (g *generator) length(fd protoreflect.FieldDescriptor) int {
+	opts := g.nanopbOpts.ForField(fd)
+	maxSize, ok := opts.MaxSize()
+	if !ok {
+		maxSize = defaultMaxSize
+	} else if fd.Kind() == protoreflect.StringKind {
+		// max_size includes the null terminator
+		maxSize--
+	}
+	if maxLength, ok := opts.MaxLength(); ok && fd.Kind() == protoreflect.StringKind {
+		maxSize = maxLength
+	}
+	switch {
+	case fd.Kind() == protoreflect.BytesKind && opts.FixedLength():
+		return int(maxSize)
+	case !g.random || maxSize <= 0:
+		return 0
+	default:
+		return g.rng.IntN(int(maxSize) + 1)
+	}
+}
+
+// intBits returns the range of an integer field in bits, taking int_size into account
+func (g *generator) intBits(fd protoreflect.FieldDescriptor, defaultBits int32) int32 {
+	switch fd.Kind() {
+	case protoreflect.Sfixed32Kind, protoreflect.Fixed32Kind, protoreflect.Sfixed64Kind, protoreflect.Fixed64Kind:
+		return defaultBits
+	}
+	if bits := g.nanopbOpts.ForField(fd).IntSize(); bits > 0 {
+		return bits
+	}
+	return defaultBits
+}
+
+func (g *generator) signed(fd protoreflect.FieldDescriptor, defaultBits int32) int64 {
+	if !g.random {
+		return 0
+	}
+	bits := g.intBits(fd, defaultBits)
+	return int64(g.rng.Uint64()) >> (64 - bits)
+}
+
+func (g *generator) unsigned(fd protoreflect.FieldDescriptor, defaultBits int32) uint64 {
+	if !g.random {
+		return 0
+	}
+	bits := g.intBits(fd, defaultBits)
+	return g.rng.Uint64() >> (64 - bits)
+}
+
+func (g *generator) value(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(g.random && g.rng.IntN(2) == 1)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(g.signed(fd, 32)))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(g.unsigned(fd, 32)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(g.signed(fd, 64))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(g.unsigned(fd, 64))
+	case protoreflect.FloatKind:
+		if !g.random {
+			return protoreflect.ValueOfFloat32(0)
+		}
+		return protoreflect.ValueOfFloat32(float32(g.rng.Float64()*2*floatRange - floatRange))
+	case protoreflect.DoubleKind:
+		if !g.random {
+			return protoreflect.ValueOfFloat64(0)
+		}
+		return protoreflect.ValueOfFloat64(math.Round((g.rng.Float64()*2*floatRange-floatRange)*1e6) / 1e6)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		if !g.random {
+			return protoreflect.ValueOfEnum(values.Get(0).Number())
+		}
+		return protoreflect.ValueOfEnum(values.Get(g.rng.IntN(values.Len())).Number())
+	case protoreflect.StringKind:
+		s := make([]byte, g.length(fd))
+		for i := range s {
+			s[i] = stringAlphabet[g.rng.IntN(len(stringAlphabet))]
+		}
+		return protoreflect.ValueOfString(string(s))
+	case protoreflect.BytesKind:
+		b := make([]byte, g.length(fd))
+		for i := 0; g.random && i < len(b); i++ {
+			b[i] = byte(g.rng.UintN(256))
+		}
+		return protoreflect.ValueOfBytes(b)
+	default:
+		return protoreflect.ValueOfMessage(g.message(fd.Message()))
+	}
+}
@@ -0,0 +1,84 @@
+package sample
+
+import (
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	snapshotDir = "../../__snapshots__"
+	testdataDir = "../../../testdata"
+)
+
+func loadExample(t *testing.T, example, protoPackageName, msgName string) (protoreflect.MessageDescriptor, *nanopb.Options) {
+	data, err := os.ReadFile(filepath.Join(snapshotDir, example, protoPackageName+".pb"))
+	require.NoError(t, err)
+	md, err := common.FindMessageDescriptor(data, msgName)
+	require.NoError(t, err)
+	opts, err := nanopb.LoadOptionsForProto(filepath.Join(testdataDir, example, protoPackageName+".proto"))
+	require.NoError(t, err)
+	return md, opts
+}
+
+func TestGenerateSkeleton(t *testing.T) {
+	md, nanopbOpts := loadExample(t, "example3", "example3", "obj")
+	opts := &Options{}
+	require.NoError(t, opts.Parse())
+
+	msg := Generate(opts, nanopbOpts, md)
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		if fd.IsList() {
+			assert.Equal(t, 1, msg.Get(fd).List().Len(), fd.Name())
+		}
+	}
+
+	data, err := Marshal(msg)
+	require.NoError(t, err)
+	parsed := dynamicpb.NewMessage(md)
+	require.NoError(t, protojson.Unmarshal(data, parsed))
+}
+
+func TestGenerateRandomRespectsOptions(t *testing.T) {
+	md, nanopbOpts := loadExample(t, "example3", "example3", "obj")
+	opts := &Options{random: true, seed: 1}
+	require.NoError(t, opts.Parse())
+
+	for n := 0; n < 100; n++ {
+		msg := Generate(opts, nanopbOpts, md)
+		for i := 0; i < md.Fields().Len(); i++ {
+			fd := md.Fields().Get(i)
+			fieldOpts := nanopbOpts.ForField(fd)
+			if maxCount, ok := fieldOpts.MaxCount(); ok {
+				assert.LessOrEqual(t, msg.Get(fd).List().Len(), int(maxCount), fd.Name())
+			}
+			if maxSize, ok := fieldOpts.MaxSize(); ok {
+				switch fd.Kind() {
+				case protoreflect.StringKind:
+					assert.Less(t, len(msg.Get(fd).String()), int(maxSize), fd.Name())
+				case protoreflect.BytesKind:
+					assert.LessOrEqual(t, len(msg.Get(fd).Bytes()), int(maxSize), fd.Name())
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateOneof(t *testing.T) {
+	md, nanopbOpts := loadExample(t, "example1", "example", "req_resp")
+	opts := &Options{}
+	require.NoError(t, opts.Parse())
+
+	msg := Generate(opts, nanopbOpts, md)
+	od := md.Oneofs().Get(0)
+	assert.Equal(t, od.Fields().Get(0), msg.WhichOneof(od))
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"fmt"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// loadDescriptor loads the compiled proto package, along with its nanopb options, from the current directory
+func loadDescriptor(protoPackageName string) (protoreflect.FileDescriptor, *nanopb.Options, error) {
+	data, err := os.ReadFile(fmt.Sprintf(pbTemplate, protoPackageName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return nil, nil, err
+	}
+
+	files, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(fds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd, err := files.FindFileByPath(protoPackageName + ".proto")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := nanopb.LoadOptionsForProto(protoPackageName + ".proto")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fd, opts, nil
+}
+
+// walkMessages calls fn for each message of a file, excluding map entries
+func walkMessages(fd protoreflect.FileDescriptor, nested bool, fn func(md protoreflect.MessageDescriptor)) {
+	var visit func(msgs protoreflect.MessageDescriptors)
+	visit = func(msgs protoreflect.MessageDescriptors) {
+		for i := 0; i < msgs.Len(); i++ {
+			md := msgs.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			fn(md)
+			if nested {
+				visit(md.Messages())
+			}
+		}
+	}
+	visit(fd.Messages())
+}
+
+// discoverMessages finds the messages in the compiled proto package which nanopb can represent as fixed-size structs
+func discoverMessages(logger *logrus.Logger, cfg *Config) ([]string, error) {
+	fd, opts, err := loadDescriptor(cfg.ProtoPackageName)
+	if err != nil {
+		return nil, err
+	}
+
+	protoMessageNames := make([]string, 0)
+	walkMessages(fd, cfg.NestedMessages, func(md protoreflect.MessageDescriptor) {
+		l := logger.WithField("protoMsg", md.FullName())
+		if issues := opts.CheckMessage(md); len(issues) > 0 {
+			for _, issue := range issues {
+				l.WithField("reason", issue.String()).Warn("skipping message which cannot be represented as a fixed-size struct")
+			}
+			return
+		}
+		l.Debug("discovered message")
+		protoMessageNames = append(protoMessageNames, opts.CTypeName(md))
+	})
+
+	return protoMessageNames, nil
+}
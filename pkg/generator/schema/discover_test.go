@@ -0,0 +1,105 @@
+package schema
+
+import (
+	"context"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const nestedProto = `syntax = "proto2";
+
+message outer {
+  message inner {
+    optional int32 x = 1;
+  }
+  message unbounded {
+    repeated int32 values = 1;
+  }
+  optional inner i = 1;
+  optional string name = 2;
+}
+
+message plain {
+  optional int32 y = 1;
+}
+`
+
+func TestDiscoverMessages(t *testing.T) {
+	example1, err := os.ReadFile("../../__snapshots__/example1/example.pb")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name             string
+		files            []*common.File
+		protoPackageName string
+		nested           bool
+		expected         []string
+		skipped          []string
+	}{
+		{
+			name: "unbounded fields",
+			files: []*common.File{
+				{Data: example1, Mode: 0644, Name: "example.pb"},
+				{Data: []byte("request.name max_size:32\nstatus.status max_size:100\n"), Mode: 0644, Name: "example.options"},
+			},
+			protoPackageName: "example",
+			expected:         []string{"my_struct", "request", "status"},
+			// response.msg has no max_size, so req_resp is skipped along with response
+			skipped: []string{"response", "req_resp"},
+		},
+		{
+			name: "top-level messages",
+			files: []*common.File{
+				{Data: []byte(nestedProto), Mode: 0644, Name: "nested.proto"},
+				{Data: []byte("outer.name max_size:16\n"), Mode: 0644, Name: "nested.options"},
+			},
+			protoPackageName: "nested",
+			expected:         []string{"outer", "plain"},
+			skipped:          []string{},
+		},
+		{
+			name: "nested messages",
+			files: []*common.File{
+				{Data: []byte(nestedProto), Mode: 0644, Name: "nested.proto"},
+				{Data: []byte("outer.name max_size:16\n"), Mode: 0644, Name: "nested.options"},
+			},
+			protoPackageName: "nested",
+			nested:           true,
+			expected:         []string{"outer", "outer_inner", "plain"},
+			skipped:          []string{"outer.unbounded"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			var names []string
+			require.NoError(t, inWorkingDir(logger, tc.files, func() error {
+				if _, err := os.Stat(tc.protoPackageName + ".pb"); os.IsNotExist(err) {
+					if err := compileDescriptor(context.Background(), logger, tc.protoPackageName); err != nil {
+						return err
+					}
+				}
+				var err error
+				names, err = discoverMessages(logger, &Config{AllMessages: true, NestedMessages: tc.nested, ProtoPackageName: tc.protoPackageName})
+				return err
+			}))
+			assert.Equal(t, tc.expected, names)
+
+			skipped := make([]string, 0)
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					skipped = append(skipped, string(entry.Data["protoMsg"].(protoreflect.FullName)))
+				}
+			}
+			assert.Equal(t, tc.skipped, skipped)
+		})
+	}
+}
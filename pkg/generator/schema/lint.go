@@ -0,0 +1,87 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"jbpf_protobuf_cli/generator/nanopb"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MessageReport describes whether a message can be used as a jbpf io channel type
+type MessageReport struct {
+	CTypeName string
+	Issues    []*nanopb.Issue
+	Layout    *nanopb.Layout
+	Name      protoreflect.FullName
+}
+
+// Lint checks that nanopb can represent the messages of a proto package as fixed-size structs, and estimates the
+// size of each struct. All messages are checked when no message names are given.
+func Lint(ctx context.Context, logger *logrus.Logger, cfg *Config) ([]*MessageReport, error) {
+	var reports []*MessageReport
+
+	err := inWorkingDir(logger, cfg.Files, func() error {
+		if err := compileDescriptor(ctx, logger, cfg.ProtoPackageName); err != nil {
+			return err
+		}
+
+		var err error
+		reports, err = checkMessages(cfg, cfg.ProtoMessageNames, cfg.NestedMessages)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// checkMessages checks and estimates the layout of the messages of the compiled proto package in the current
+// directory. All messages are checked when no message names are given.
+func checkMessages(cfg *Config, protoMessageNames []string, nested bool) ([]*MessageReport, error) {
+	fd, opts, err := loadDescriptor(cfg.ProtoPackageName)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[string]bool)
+	for _, name := range protoMessageNames {
+		requested[name] = false
+	}
+	layoutOpts := nanopb.NewLayoutOptions(cfg.CompilerOptions)
+
+	reports := make([]*MessageReport, 0)
+	walkMessages(fd, nested || len(requested) > 0, func(md protoreflect.MessageDescriptor) {
+		cTypeName := opts.CTypeName(md)
+		if len(requested) > 0 {
+			_, byCTypeName := requested[cTypeName]
+			_, byFullName := requested[string(md.FullName())]
+			if !byCTypeName && !byFullName {
+				return
+			}
+			requested[cTypeName] = true
+			requested[string(md.FullName())] = true
+		}
+
+		report := &MessageReport{CTypeName: cTypeName, Issues: opts.CheckMessage(md), Name: md.FullName()}
+		if len(report.Issues) == 0 {
+			layout, err := opts.Layout(md, layoutOpts)
+			if err != nil {
+				report.Issues = append(report.Issues, &nanopb.Issue{Name: md.FullName(), Reason: err.Error()})
+			} else {
+				report.Layout = layout
+			}
+		}
+		reports = append(reports, report)
+	})
+
+	for _, name := range protoMessageNames {
+		if !requested[name] {
+			return nil, fmt.Errorf("message %s not found in %s.proto", name, cfg.ProtoPackageName)
+		}
+	}
+
+	return reports, nil
+}
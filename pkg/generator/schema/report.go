@@ -0,0 +1,113 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	reportTemplate = "%s.report.json"
+)
+
+// PackageReport describes the C structs generated for a proto package, as measured by the C compiler
+type PackageReport struct {
+	Build    *nanopb.BuildInfo
+	Messages []*MessageReport
+	Package  string
+}
+
+// withDependencies returns the requested messages of the compiled proto package in the current directory followed by
+// the messages of the package their fields use, directly or through other messages
+func withDependencies(cfg *Config, protoMessageNames []string) ([]string, error) {
+	fd, opts, err := loadDescriptor(cfg.ProtoPackageName)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]protoreflect.MessageDescriptor)
+	walkMessages(fd, true, func(md protoreflect.MessageDescriptor) {
+		byName[opts.CTypeName(md)] = md
+		byName[string(md.FullName())] = md
+	})
+
+	names := append([]string{}, protoMessageNames...)
+	seen := make(map[protoreflect.FullName]bool)
+	var visit func(md protoreflect.MessageDescriptor, requested bool)
+	visit = func(md protoreflect.MessageDescriptor, requested bool) {
+		if seen[md.FullName()] {
+			return
+		}
+		seen[md.FullName()] = true
+		if !requested {
+			names = append(names, string(md.FullName()))
+		}
+		for i := 0; i < md.Fields().Len(); i++ {
+			if dep := md.Fields().Get(i).Message(); dep != nil && !dep.IsMapEntry() && dep.ParentFile().Path() == fd.Path() {
+				visit(dep, false)
+			}
+		}
+	}
+	for _, name := range protoMessageNames {
+		// unknown names are reported by checkMessages
+		if md, ok := byName[name]; ok {
+			visit(md, true)
+		}
+	}
+	return names, nil
+}
+
+// probeMessages checks the messages of the generated proto package in the current directory, the requested ones and
+// those they depend on or every message if none are requested, and measures the layout of those which can be
+// represented as fixed-size structs when probe is set
+func probeMessages(ctx context.Context, logger *logrus.Logger, cfg *Config, protoMessageNames []string, probe bool) ([]*MessageReport, error) {
+	if len(protoMessageNames) > 0 {
+		var err error
+		if protoMessageNames, err = withDependencies(cfg, protoMessageNames); err != nil {
+			return nil, err
+		}
+	}
+
+	reports, err := checkMessages(cfg, protoMessageNames, true)
+	if err != nil || !probe {
+		return reports, err
+	}
+
+	layouts := make([]*nanopb.Layout, 0, len(reports))
+	for _, r := range reports {
+		if r.Layout != nil {
+			layouts = append(layouts, r.Layout)
+		}
+	}
+
+	if err := nanopb.ProbeLayouts(ctx, logger, cfg.CompilerOptions, cfg.ProtoPackageName+".pb.h", layouts); err != nil {
+		return nil, err
+	}
+
+	return reports, nil
+}
+
+// generateReport writes the report of the probed messages
+func generateReport(cfg *Config, reports []*MessageReport) (*common.File, error) {
+	data, err := json.MarshalIndent(&PackageReport{
+		Build:    cfg.CompilerOptions.BuildInfo(cfg.CompilerOptions.CompileArgs()),
+		Messages: reports,
+		Package:  cfg.ProtoPackageName,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	reportFile := fmt.Sprintf(reportTemplate, cfg.ProtoPackageName)
+	if err := os.WriteFile(reportFile, data, 0644); err != nil {
+		return nil, err
+	}
+
+	return common.NewFile(reportFile)
+}
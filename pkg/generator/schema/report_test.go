@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"jbpf_protobuf_cli/common"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDependencies(t *testing.T) {
+	files := make([]*common.File, 0)
+	for _, path := range []string{
+		"../../__snapshots__/example1/example.pb",
+		"../../../testdata/example1/example.proto",
+		"../../../testdata/example1/example.options",
+	} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		files = append(files, &common.File{Data: data, Mode: 0644, Name: filepath.Base(path)})
+	}
+
+	testCases := []struct {
+		name              string
+		protoMessageNames []string
+		expected          []string
+	}{
+		{"no dependencies", []string{"my_struct"}, []string{"my_struct"}},
+		{"nested message", []string{"status"}, []string{"status", "my_struct"}},
+		{"oneof members", []string{"req_resp"}, []string{"req_resp", "request", "response"}},
+		{"requested dependency", []string{"request", "req_resp"}, []string{"request", "req_resp", "response"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			require.NoError(t, inWorkingDir(logrus.New(), files, func() error {
+				var err error
+				names, err = withDependencies(&Config{ProtoPackageName: "example"}, tc.protoMessageNames)
+				return err
+			}))
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
@@ -2,14 +2,18 @@ package schema
 
 import (
 	"context"
+	"crypto/sha1"
 	"errors"
 	"fmt"
 	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/compiler"
 	"jbpf_protobuf_cli/generator/nanopb"
 	"jbpf_protobuf_cli/generator/stream"
 	"os"
+	"text/template"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -22,16 +26,22 @@ var (
 
 // Config for schema file generation
 type Config struct {
+	AllMessages       bool
+	CompilerOptions   *nanopb.CompilerOptions
 	Files             []*common.File
+	NestedMessages    bool
 	ProtoMessageNames []string
 	ProtoPackageName  string
+	Report            bool
+	// SerializerTemplate replaces the default serializer template when set
+	SerializerTemplate *template.Template
 }
 
-// Generate generates files for schema inside a temporary directory
-func Generate(ctx context.Context, logger *logrus.Logger, cfg *Config) ([]*common.File, error) {
+// inWorkingDir writes files to a temporary directory and runs fn from within it
+func inWorkingDir(logger *logrus.Logger, files []*common.File, fn func() error) error {
 	wd, err := os.MkdirTemp("", "temp*")
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func() {
 		if err = os.RemoveAll(wd); err != nil {
@@ -41,10 +51,10 @@ func Generate(ctx context.Context, logger *logrus.Logger, cfg *Config) ([]*commo
 
 	originalWd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if err := os.Chdir(wd); err != nil {
-		return nil, err
+		return err
 	}
 	defer func() {
 		if err := os.Chdir(originalWd); err != nil {
@@ -52,60 +62,152 @@ func Generate(ctx context.Context, logger *logrus.Logger, cfg *Config) ([]*commo
 		}
 	}()
 
-	for _, fileDetails := range cfg.Files {
+	for _, fileDetails := range files {
 		logger.Debug("Writing file: ", fileDetails.Name)
 		f, err := os.Create(fileDetails.Name)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		n, err := f.Write(fileDetails.Data)
 		if n != len(fileDetails.Data) {
 			err = errors.Join(err, fmt.Errorf("expected to write %d bytes, wrote %d", len(fileDetails.Data), n))
 		}
 		if err != nil {
-			return nil, errors.Join(err, f.Close())
+			return errors.Join(err, f.Close())
 		}
 		logger.Debug("Closed file: ", fileDetails.Name)
 		if err = f.Close(); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	if err := errors.Join(
-		common.RunSubprocess(
-			ctx,
-			logger,
-			nanopb.GeneratorPath,
-			cfg.ProtoPackageName+".proto",
-		),
-		common.RunSubprocess(
-			ctx,
-			logger,
-			nanopb.ProtocPath,
-			cfg.ProtoPackageName+".proto",
-			"-o",
-			fmt.Sprintf(pbTemplate, cfg.ProtoPackageName),
-		)); err != nil {
-		return nil, err
+	return fn()
+}
+
+// compileDescriptor compiles the proto package in the current directory to a FileDescriptorSet
+func compileDescriptor(ctx context.Context, logger *logrus.Logger, protoPackageName string) error {
+	protoFile := protoPackageName + ".proto"
+	logger.WithField("filename", protoFile).Debug("Compiling descriptor")
+	fds, err := compiler.Compile(ctx, []string{protoFile}, nil, false)
+	if err != nil {
+		return err
+	}
+
+	data, err := proto.Marshal(fds)
+	if err != nil {
+		return err
 	}
 
-	generatedFiles := make([]*common.File, 0, len(cfg.ProtoMessageNames)*2+3)
+	return os.WriteFile(fmt.Sprintf(pbTemplate, protoPackageName), data, 0644)
+}
 
-	for _, fTemplate := range generatedFileTemplate {
-		f := fmt.Sprintf(fTemplate, cfg.ProtoPackageName)
-		fileData, err := common.NewFile(f)
-		if err != nil {
-			return nil, err
+// serializerTemplateData returns the template data for a message, with its fields if its layout was probed
+func serializerTemplateData(logger *logrus.Logger, cfg *Config, reports []*MessageReport, probed bool, packageChecksum, protoMessageName string) (*stream.SerializerTemplateData, error) {
+	for _, r := range reports {
+		if r.CTypeName != protoMessageName && string(r.Name) != protoMessageName {
+			continue
+		}
+
+		data := &stream.SerializerTemplateData{
+			Fields:               make([]*stream.FieldTemplateData, 0),
+			PackageChecksum:      packageChecksum,
+			ProtoMessageFullName: string(r.Name),
+			ProtoMessageName:     protoMessageName,
+			ProtoPackageName:     cfg.ProtoPackageName,
+		}
+		if !probed {
+			return data, nil
+		}
+		if r.Layout == nil {
+			l := logger.WithField("protoMsg", r.Name)
+			for _, issue := range r.Issues {
+				l.WithField("reason", issue.String()).Warn("message cannot be represented as a fixed-size struct")
+			}
+			return data, nil
 		}
-		generatedFiles = append(generatedFiles, fileData)
+		data.Fields = stream.NewFieldTemplateData(r.Layout)
+		data.MessageSize = r.Layout.Size
+		return data, nil
 	}
 
-	for _, protoMessageName := range cfg.ProtoMessageNames {
-		files, err := stream.Generate(ctx, logger, cfg.ProtoPackageName, protoMessageName)
+	return nil, fmt.Errorf("message %s not found in %s.proto", protoMessageName, cfg.ProtoPackageName)
+}
+
+// Generate generates files for schema inside a temporary directory
+func Generate(ctx context.Context, logger *logrus.Logger, cfg *Config) ([]*common.File, error) {
+	var generatedFiles []*common.File
+
+	err := inWorkingDir(logger, cfg.Files, func() error {
+		if err := errors.Join(
+			common.RunSubprocess(
+				ctx,
+				logger,
+				nanopb.GeneratorPath,
+				cfg.ProtoPackageName+".proto",
+			),
+			compileDescriptor(ctx, logger, cfg.ProtoPackageName),
+		); err != nil {
+			return err
+		}
+
+		protoMessageNames := cfg.ProtoMessageNames
+		if len(protoMessageNames) == 0 && cfg.AllMessages {
+			var err error
+			protoMessageNames, err = discoverMessages(logger, cfg)
+			if err != nil {
+				return err
+			}
+		}
+
+		generatedFiles = make([]*common.File, 0, len(protoMessageNames)*3+4)
+
+		for _, fTemplate := range generatedFileTemplate {
+			f := fmt.Sprintf(fTemplate, cfg.ProtoPackageName)
+			fileData, err := common.NewFile(f)
+			if err != nil {
+				return err
+			}
+			generatedFiles = append(generatedFiles, fileData)
+		}
+
+		if len(protoMessageNames) == 0 && !cfg.Report {
+			return nil
+		}
+
+		// the default template only needs the names of the messages, measuring their layouts is only worth compiling
+		// a probe for a report or a custom template, which may use the fields
+		probe := cfg.Report || cfg.SerializerTemplate != nil
+		reports, err := probeMessages(ctx, logger, cfg, protoMessageNames, probe)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		generatedFiles = append(generatedFiles, files...)
+
+		// the compiled proto package is the first generated file
+		packageChecksum := fmt.Sprintf("%x", sha1.Sum(generatedFiles[0].Data))
+		for _, protoMessageName := range protoMessageNames {
+			data, err := serializerTemplateData(logger, cfg, reports, probe, packageChecksum, protoMessageName)
+			if err != nil {
+				return err
+			}
+			files, err := stream.Generate(ctx, logger, cfg.CompilerOptions, cfg.SerializerTemplate, data)
+			if err != nil {
+				return err
+			}
+			generatedFiles = append(generatedFiles, files...)
+		}
+
+		if cfg.Report {
+			reportFile, err := generateReport(cfg, reports)
+			if err != nil {
+				return err
+			}
+			generatedFiles = append(generatedFiles, reportFile)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return generatedFiles, nil
@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"context"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var goldenExtensions = map[string]bool{".c": true, ".h": true, ".pb": true}
+
+func envOrDefault(t *testing.T, name, defaultValue string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		value = defaultValue
+	}
+	abs, err := filepath.Abs(value)
+	require.NoError(t, err)
+	return abs
+}
+
+// TestGenerateGolden generates the serde assets of each example and compares them against the golden files in the
+// snapshot directory. Set REGENERATE_SNAPSHOT=true to update the golden files.
+func TestGenerateGolden(t *testing.T) {
+	if nanopb.Path == "" {
+		t.Skip(`"NANO_PB" not set`)
+	}
+	workdir := envOrDefault(t, "TEST_WORKDIR", "../../../testdata")
+	snapshotdir := envOrDefault(t, "SNAPSHOT_DIR", "../../__snapshots__")
+	regenerate := os.Getenv("REGENERATE_SNAPSHOT") == "true"
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	ctx := context.Background()
+
+	testCases := []struct {
+		example           string
+		protoPackageName  string
+		protoMessageNames []string
+	}{
+		{"example1", "example", []string{"req_resp", "status"}},
+		{"example2", "example2", []string{"item"}},
+		{"example3", "example3", []string{"obj"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.example, func(t *testing.T) {
+			exampleDir := filepath.Join(workdir, tc.example)
+			files, err := nanopb.FindFiles(logger, exampleDir)
+			require.NoError(t, err)
+
+			generated, err := Generate(ctx, logger, &Config{
+				CompilerOptions:   &nanopb.CompilerOptions{},
+				Files:             files,
+				ProtoMessageNames: tc.protoMessageNames,
+				ProtoPackageName:  tc.protoPackageName,
+			})
+			require.NoError(t, err)
+
+			for _, f := range generated {
+				if !goldenExtensions[filepath.Ext(f.Name)] {
+					continue
+				}
+				goldenFile := filepath.Join(snapshotdir, tc.example, f.Name)
+				if regenerate {
+					require.NoError(t, os.MkdirAll(filepath.Dir(goldenFile), 0755))
+					require.NoError(t, os.WriteFile(goldenFile, f.Data, 0644))
+					continue
+				}
+				golden, err := os.ReadFile(goldenFile)
+				require.NoError(t, err)
+				assert.Equal(t, string(golden), string(f.Data), "file %s does not match golden file", f.Name)
+			}
+		})
+	}
+}
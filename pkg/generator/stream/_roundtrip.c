@@ -0,0 +1,69 @@
+// Round trips protobuf encoded messages through a serializer library, without requiring cgo.
+// Usage: roundtrip <serializer.so> <max encoded size>
+// Reads an encoded message from stdin, decodes it into a struct with jbpf_io_deserialize, then writes the result of
+// encoding the struct with jbpf_io_serialize to stdout.
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+
+typedef int (*jbpf_io_serialize_t)(void*, size_t, char*, size_t);
+typedef int (*jbpf_io_deserialize_t)(char*, size_t, void*, size_t);
+
+int main(int argc, char** argv) {
+	if (argc != 3) {
+		fprintf(stderr, "usage: %s <serializer.so> <max encoded size>\n", argv[0]);
+		return 1;
+	}
+
+	size_t out_size = strtoul(argv[2], NULL, 10);
+	size_t in_cap = 4096, in_size = 0, n;
+	char* in = malloc(in_cap);
+	char* out = malloc(out_size);
+	if (in == NULL || out == NULL) {
+		fprintf(stderr, "out of memory\n");
+		return 1;
+	}
+	while ((n = fread(in + in_size, 1, in_cap - in_size, stdin)) > 0) {
+		in_size += n;
+		if (in_size == in_cap) {
+			in_cap *= 2;
+			if ((in = realloc(in, in_cap)) == NULL) {
+				fprintf(stderr, "out of memory\n");
+				return 1;
+			}
+		}
+	}
+
+	void* lib = dlopen(argv[1], RTLD_NOW | RTLD_LOCAL);
+	if (lib == NULL) {
+		fprintf(stderr, "dlopen: %s\n", dlerror());
+		return 1;
+	}
+	jbpf_io_serialize_t serialize = (jbpf_io_serialize_t)dlsym(lib, "jbpf_io_serialize");
+	jbpf_io_deserialize_t deserialize = (jbpf_io_deserialize_t)dlsym(lib, "jbpf_io_deserialize");
+	const uint32_t* msg_size = (const uint32_t*)dlsym(lib, "proto_message_size");
+	if (serialize == NULL || deserialize == NULL || msg_size == NULL) {
+		fprintf(stderr, "dlsym: jbpf_io_serialize, jbpf_io_deserialize and proto_message_size must be exported\n");
+		return 1;
+	}
+
+	void* msg = calloc(1, *msg_size);
+	if (msg == NULL) {
+		fprintf(stderr, "out of memory\n");
+		return 1;
+	}
+	if (!deserialize(in, in_size, msg, *msg_size)) {
+		fprintf(stderr, "jbpf_io_deserialize failed to decode %zu bytes into a %u byte struct\n", in_size, *msg_size);
+		return 2;
+	}
+
+	int written = serialize(msg, *msg_size, out, out_size);
+	if (written < 0) {
+		fprintf(stderr, "jbpf_io_serialize failed to encode a %u byte struct\n", *msg_size);
+		return 3;
+	}
+
+	fwrite(out, 1, written, stdout);
+	return 0;
+}
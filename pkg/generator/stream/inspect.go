@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+)
+
+const (
+	// ChecksumSymbol is the symbol holding the hex encoded SHA1 checksum of the compiled proto package a serializer
+	// was generated from
+	ChecksumSymbol = "jbpf_io_schema_checksum"
+	// MessageNameSymbol is the symbol holding the full name of the message a serializer was generated for
+	MessageNameSymbol = "jbpf_io_schema_msg_name"
+)
+
+// ErrNoFingerprint is returned by Inspect for serializers generated by older versions or custom templates, which do not
+// embed a schema fingerprint
+var ErrNoFingerprint = errors.New("no schema fingerprint")
+
+// SerializerInfo is the schema fingerprint embedded in a serializer library
+type SerializerInfo struct {
+	Checksum    string
+	MessageName string
+}
+
+// readStringSymbol reads the value of a NUL terminated string symbol from an ELF file
+func readStringSymbol(f *elf.File, symbols []elf.Symbol, name string) (string, error) {
+	for _, sym := range symbols {
+		if sym.Name != name || sym.Section == elf.SHN_UNDEF {
+			continue
+		}
+		if int(sym.Section) >= len(f.Sections) {
+			return "", fmt.Errorf("symbol %s is not in a section with data", name)
+		}
+		// symbol values of shared libraries are addresses, so the section must be loaded
+		sec := f.Sections[sym.Section]
+		if sec.Type == elf.SHT_NOBITS || sec.Flags&elf.SHF_ALLOC == 0 {
+			return "", fmt.Errorf("symbol %s is not in a section with data", name)
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return "", err
+		}
+		offset := sym.Value - sec.Addr
+		if sym.Value < sec.Addr || offset+sym.Size > uint64(len(data)) {
+			return "", fmt.Errorf("symbol %s is out of range of section %s", name, sec.Name)
+		}
+		return string(bytes.TrimRight(data[offset:offset+sym.Size], "\x00")), nil
+	}
+	return "", fmt.Errorf("%w: symbol %s not found, the serializer may have been generated by an older version or a custom template", ErrNoFingerprint, name)
+}
+
+// Inspect reads the schema fingerprint from a serializer library
+func Inspect(soFile string) (*SerializerInfo, error) {
+	f, err := elf.Open(soFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	symbols, err := f.DynamicSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := readStringSymbol(f, symbols, ChecksumSymbol)
+	if err != nil {
+		return nil, err
+	}
+	messageName, err := readStringSymbol(f, symbols, MessageNameSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SerializerInfo{Checksum: checksum, MessageName: messageName}, nil
+}
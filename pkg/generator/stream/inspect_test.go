@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildLibrary builds a shared library from C source with the host C compiler
+func buildLibrary(t *testing.T, src string) string {
+	dir := t.TempDir()
+	cFile := filepath.Join(dir, "serializer.c")
+	soFile := filepath.Join(dir, "serializer.so")
+	require.NoError(t, os.WriteFile(cFile, []byte(src), 0644))
+	require.NoError(t, common.RunSubprocess(context.Background(), logrus.New(), "cc", "-shared", "-fPIC", cFile, "-o", soFile))
+	return soFile
+}
+
+func TestInspect(t *testing.T) {
+	testCases := []struct {
+		name     string
+		src      string
+		expected *SerializerInfo
+		err      string
+		// noFingerprint is set when the error is ErrNoFingerprint
+		noFingerprint bool
+	}{
+		{
+			name: "fingerprint",
+			src: `const char jbpf_io_schema_checksum[] = "0123456789abcdef0123456789abcdef01234567";
+const char jbpf_io_schema_msg_name[] = "example.status";
+int padding[64] = {1};
+`,
+			expected: &SerializerInfo{Checksum: "0123456789abcdef0123456789abcdef01234567", MessageName: "example.status"},
+		},
+		{
+			name: "writable data",
+			src: `char jbpf_io_schema_checksum[] = "abc";
+char jbpf_io_schema_msg_name[] = "example2.item";
+`,
+			expected: &SerializerInfo{Checksum: "abc", MessageName: "example2.item"},
+		},
+		{
+			name:          "no fingerprint",
+			src:           "int jbpf_io_serialize(void) { return 0; }\n",
+			err:           "symbol jbpf_io_schema_checksum not found",
+			noFingerprint: true,
+		},
+		{
+			name: "uninitialized",
+			src: `char jbpf_io_schema_checksum[41];
+const char jbpf_io_schema_msg_name[] = "example.status";
+`,
+			err: "symbol jbpf_io_schema_checksum is not in a section with data",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := Inspect(buildLibrary(t, tc.src))
+			if len(tc.err) > 0 {
+				assert.ErrorContains(t, err, tc.err)
+				assert.Equal(t, tc.noFingerprint, errors.Is(err, ErrNoFingerprint))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, info)
+		})
+	}
+
+	_, err := Inspect(filepath.Join(t.TempDir(), "missing.so"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoFingerprint)
+}
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"jbpf_protobuf_cli/common"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	defaultMaxEncodedSize = 1 << 20
+	roundTripC            = "roundtrip.c"
+	roundTripExe          = "roundtrip"
+)
+
+//go:embed _roundtrip.c
+var roundTripSrc []byte
+
+// RoundTripper round trips encoded messages through serializer libraries. Libraries are loaded by a helper process,
+// so they must be built for the host.
+type RoundTripper struct {
+	dir    string
+	exe    string
+	logger *logrus.Logger
+
+	// MaxEncodedSize is the size of the buffer passed to jbpf_io_serialize
+	MaxEncodedSize int
+}
+
+// NewRoundTripper builds the round trip helper with a host C compiler
+func NewRoundTripper(ctx context.Context, logger *logrus.Logger, cc string) (*RoundTripper, error) {
+	dir, err := os.MkdirTemp("", "roundtrip*")
+	if err != nil {
+		return nil, err
+	}
+	r := &RoundTripper{
+		dir:            dir,
+		exe:            filepath.Join(dir, roundTripExe),
+		logger:         logger,
+		MaxEncodedSize: defaultMaxEncodedSize,
+	}
+
+	src := filepath.Join(dir, roundTripC)
+	if err := os.WriteFile(src, roundTripSrc, 0644); err != nil {
+		r.Close()
+		return nil, err
+	}
+	if err := common.RunSubprocess(ctx, logger, cc, src, "-o", r.exe, "-ldl"); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Close removes the round trip helper
+func (r *RoundTripper) Close() {
+	if err := os.RemoveAll(r.dir); err != nil {
+		r.logger.WithField("directory", r.dir).WithError(err).Error("failed to remove round trip helper")
+	}
+}
+
+// RoundTrip decodes an encoded message into a struct with jbpf_io_deserialize, and returns the result of encoding the
+// struct again with jbpf_io_serialize
+func (r *RoundTripper) RoundTrip(ctx context.Context, soFile string, encoded []byte) ([]byte, error) {
+	absSoFile, err := filepath.Abs(soFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.exe, absSoFile, strconv.Itoa(r.MaxEncodedSize))
+	cmd.Stdin = bytes.NewReader(encoded)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(soFile), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// Verify checks a JSON encoded message survives a round trip through a serializer library unchanged
+func (r *RoundTripper) Verify(ctx context.Context, soFile string, md protoreflect.MessageDescriptor, jsonData []byte) error {
+	want := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal(jsonData, want); err != nil {
+		return err
+	}
+	encoded, err := proto.Marshal(want)
+	if err != nil {
+		return err
+	}
+
+	roundTripped, err := r.RoundTrip(ctx, soFile, encoded)
+	if err != nil {
+		return err
+	}
+
+	got := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(roundTripped, got); err != nil {
+		return fmt.Errorf("failed to decode the output of jbpf_io_serialize: %w", err)
+	}
+	if !proto.Equal(want, got) {
+		wantJSON, _ := protojson.Marshal(want)
+		gotJSON, _ := protojson.Marshal(got)
+		return fmt.Errorf("message changed by round trip, expected %s, got %s", wantJSON, gotJSON)
+	}
+
+	return nil
+}
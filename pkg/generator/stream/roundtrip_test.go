@@ -0,0 +1,91 @@
+package stream_test
+
+import (
+	"context"
+	"jbpf_protobuf_cli/common"
+	"jbpf_protobuf_cli/generator/nanopb"
+	"jbpf_protobuf_cli/generator/schema"
+	"jbpf_protobuf_cli/generator/stream"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const testdataDir = "../../../testdata"
+
+// TestRoundTrip generates the serializers of each example, then round trips each sample "{message}.json" or
+// "{message}.{variant}.json" in the example directory through the serializer built for its message
+func TestRoundTrip(t *testing.T) {
+	if nanopb.Path == "" {
+		t.Skip(`"NANO_PB" not set`)
+	}
+	if _, err := exec.LookPath("cc"); err != nil {
+		t.Skip("no host C compiler")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	ctx := context.Background()
+
+	roundTripper, err := stream.NewRoundTripper(ctx, logger, "cc")
+	require.NoError(t, err)
+	defer roundTripper.Close()
+
+	testCases := []struct {
+		example           string
+		protoPackageName  string
+		protoMessageNames []string
+	}{
+		{"example1", "example", []string{"req_resp", "status"}},
+		{"example2", "example2", []string{"item"}},
+		{"example3", "example3", []string{"obj"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.example, func(t *testing.T) {
+			exampleDir, err := filepath.Abs(filepath.Join(testdataDir, tc.example))
+			require.NoError(t, err)
+			files, err := nanopb.FindFiles(logger, exampleDir)
+			require.NoError(t, err)
+
+			generated, err := schema.Generate(ctx, logger, &schema.Config{
+				CompilerOptions:   &nanopb.CompilerOptions{},
+				Files:             files,
+				ProtoMessageNames: tc.protoMessageNames,
+				ProtoPackageName:  tc.protoPackageName,
+			})
+			require.NoError(t, err)
+			outDir := t.TempDir()
+			require.NoError(t, common.WriteFilesToDirectory(logger, outDir, generated))
+
+			descriptor, err := os.ReadFile(filepath.Join(outDir, tc.protoPackageName+".pb"))
+			require.NoError(t, err)
+			pkgFiles, err := common.NewFilesFromCompiledProto(descriptor)
+			require.NoError(t, err)
+			fd, err := pkgFiles.FindFileByPath(tc.protoPackageName + ".proto")
+			require.NoError(t, err)
+
+			samples, err := filepath.Glob(filepath.Join(exampleDir, "*.json"))
+			require.NoError(t, err)
+			for _, sample := range samples {
+				protoMessageName, _, _ := strings.Cut(strings.TrimSuffix(filepath.Base(sample), ".json"), ".")
+				t.Run(filepath.Base(sample), func(t *testing.T) {
+					md := fd.Messages().ByName(protoreflect.Name(protoMessageName))
+					require.NotNil(t, md, "message %s not found", protoMessageName)
+					jsonData, err := os.ReadFile(sample)
+					require.NoError(t, err)
+
+					soFile := filepath.Join(outDir, tc.protoPackageName+":"+protoMessageName+"_serializer.so")
+					assert.NoError(t, roundTripper.Verify(ctx, soFile, md, jsonData))
+				})
+			}
+		})
+	}
+}
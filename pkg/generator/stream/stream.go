@@ -2,6 +2,7 @@ package stream
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"jbpf_protobuf_cli/common"
@@ -13,14 +14,12 @@ import (
 )
 
 const (
-	defaultPbField32Bit       = "1"
-	envVarPbField32Bit        = "PB_FIELD_32BIT"
-	envVarPbMaxRequiredFields = "PB_MAX_REQUIRED_FIELDS"
-	serializerC               = "%s:%s_serializer.c"
-	serializerSO              = "%s:%s_serializer.so"
+	serializerBuildInfo = "%s:%s_serializer.buildinfo.json"
+	serializerC         = "%s:%s_serializer.c"
+	serializerSO        = "%s:%s_serializer.so"
 )
 
-func createNewFileWithTmpl(logger *logrus.Logger, filename string, tmpl *template.Template, data SerializerTemplateData) error {
+func createNewFileWithTmpl(logger *logrus.Logger, filename string, tmpl *template.Template, data *SerializerTemplateData) error {
 	l := logger.WithField("filename", filename)
 
 	f, err := os.Create(filename)
@@ -42,39 +41,44 @@ func createNewFileWithTmpl(logger *logrus.Logger, filename string, tmpl *templat
 	return nil
 }
 
-// Generate creates files for a stream
-func Generate(ctx context.Context, logger *logrus.Logger, protoPackageName, protoMessageName string) ([]*common.File, error) {
+// Generate creates files for a stream. The default serializer template is used when tmpl is nil.
+func Generate(ctx context.Context, logger *logrus.Logger, compilerOpts *nanopb.CompilerOptions, tmpl *template.Template, data *SerializerTemplateData) ([]*common.File, error) {
+	protoPackageName, protoMessageName := data.ProtoPackageName, data.ProtoMessageName
+	if tmpl == nil {
+		tmpl = serializerTemplate
+	}
+
 	cFile := fmt.Sprintf(serializerC, protoPackageName, protoMessageName)
 	soFile := fmt.Sprintf(serializerSO, protoPackageName, protoMessageName)
+	buildInfoFile := fmt.Sprintf(serializerBuildInfo, protoPackageName, protoMessageName)
 
-	if err := createNewFileWithTmpl(logger,
-		cFile,
-		serializerTemplate,
-		SerializerTemplateData{ProtoPackageName: protoPackageName, ProtoMessageName: protoMessageName},
-	); err != nil {
+	if err := createNewFileWithTmpl(logger, cFile, tmpl, data); err != nil {
 		return nil, err
 	}
 
-	pbField32Bit := os.Getenv(envVarPbField32Bit)
-	if pbField32Bit == "" {
-		pbField32Bit = defaultPbField32Bit
-	}
-	args := []string{
-		"-I",
-		nanopb.Path,
+	args := append(compilerOpts.CompileArgs(),
 		cFile,
-		protoPackageName + ".pb.c",
+		protoPackageName+".pb.c",
 		nanopb.PbCommonCPath,
 		nanopb.PbDecodeCPath,
 		nanopb.PbEncodeCPath,
-		"-DPB_FIELD_32BIT=" + pbField32Bit,
+		"-shared",
+		"-fPIC",
+		"-o",
+		soFile,
+	)
+	args = append(args, compilerOpts.LinkArgs()...)
+
+	if err := common.RunSubprocess(ctx, logger, compilerOpts.CC(), args...); err != nil {
+		return nil, err
 	}
-	if pbMaxRequiredFields := os.Getenv(envVarPbMaxRequiredFields); len(pbMaxRequiredFields) > 0 {
-		args = append(args, "-DPB_MAX_REQUIRED_FIELDS="+pbMaxRequiredFields)
+
+	if err := validateExports(soFile); err != nil {
+		return nil, err
 	}
-	args = append(args, "-shared", "-fPIC", "-o", soFile)
 
-	if err := common.RunSubprocess(ctx, logger, "cc", args...); err != nil {
+	buildInfo, err := json.MarshalIndent(compilerOpts.BuildInfo(args), "", "  ")
+	if err != nil {
 		return nil, err
 	}
 
@@ -84,5 +88,9 @@ func Generate(ctx context.Context, logger *logrus.Logger, protoPackageName, prot
 		return nil, err
 	}
 
-	return []*common.File{cFileData, soFileData}, nil
+	return []*common.File{
+		cFileData,
+		soFileData,
+		{Data: append(buildInfo, '\n'), Mode: 0644, Name: buildInfoFile},
+	}, nil
 }
@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, tpl string) string {
+	path := filepath.Join(t.TempDir(), "custom.c.tpl")
+	require.NoError(t, os.WriteFile(path, []byte(tpl), 0644))
+	return path
+}
+
+func TestLoadTemplate(t *testing.T) {
+	tmpl, err := LoadTemplate(writeTemplate(t, "/* {{.ProtoMessageFullName}} */\n"))
+	require.NoError(t, err)
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, &SerializerTemplateData{ProtoMessageFullName: "example.status"}))
+	assert.Equal(t, "/* example.status */\n", out.String())
+
+	_, err = LoadTemplate(writeTemplate(t, "{{range .Fields}}\n"))
+	assert.ErrorContains(t, err, "template: custom.c.tpl:2: unexpected EOF")
+
+	_, err = LoadTemplate(filepath.Join(t.TempDir(), "missing.c.tpl"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidateExports(t *testing.T) {
+	testCases := []struct {
+		name string
+		tpl  string
+		err  string
+	}{
+		{
+			name: "both exported",
+			tpl: `int jbpf_io_serialize(void) { return 0; }
+int jbpf_io_deserialize(void) { return 0; }
+`,
+		},
+		{
+			name: "deserialize missing",
+			tpl:  "/* {{.ProtoMessageName}} */\nint jbpf_io_serialize(void) { return 0; }\n",
+			err:  "does not export jbpf_io_deserialize, check the serializer template",
+		},
+		{
+			name: "deserialize not exported",
+			tpl: `int jbpf_io_serialize(void) { return 0; }
+static int jbpf_io_deserialize(void) { return 0; }
+int (*keep)(void) = jbpf_io_deserialize;
+`,
+			err: "does not export jbpf_io_deserialize, check the serializer template",
+		},
+		{
+			name: "data instead of a function",
+			tpl: `int jbpf_io_serialize = 0;
+int jbpf_io_deserialize(void) { return 0; }
+`,
+			err: "does not export jbpf_io_serialize, check the serializer template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := LoadTemplate(writeTemplate(t, tc.tpl))
+			require.NoError(t, err)
+			var src strings.Builder
+			require.NoError(t, tmpl.Execute(&src, &SerializerTemplateData{ProtoMessageName: "status"}))
+
+			err = validateExports(buildLibrary(t, src.String()))
+			if len(tc.err) > 0 {
+				assert.ErrorContains(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package stream
 
 import (
 	_ "embed"
+	"jbpf_protobuf_cli/generator/nanopb"
 	"log"
+	"os"
+	"path/filepath"
 	"text/template"
 )
 
@@ -11,10 +14,32 @@ var tpl string
 
 var serializerTemplate *template.Template
 
+// FieldTemplateData describes a proto field of the message, and the C struct member holding its value
+type FieldTemplateData struct {
+	// CountMember is the name of the _count member of a repeated field, if any
+	CountMember string
+	CType       string
+	// HasMember is the name of the has_ member of an optional field, if any
+	HasMember string
+	Member    string
+	Name      string
+	Number    int32
+	Offset    int
+	Size      int
+}
+
 // SerializerTemplateData is the data passed to the serializer template
 type SerializerTemplateData struct {
-	ProtoMessageName string
-	ProtoPackageName string
+	// Fields are empty when the message cannot be represented as a fixed-size struct, and are only measured when
+	// generating from a custom template or with a report
+	Fields []*FieldTemplateData
+	// MessageSize is sizeof() the message struct, as measured by the C compiler, or 0 if unknown or not measured
+	MessageSize int
+	// PackageChecksum is the hex encoded SHA1 checksum of the compiled proto package
+	PackageChecksum      string
+	ProtoMessageFullName string
+	ProtoMessageName     string
+	ProtoPackageName     string
 }
 
 func init() {
@@ -26,3 +51,47 @@ func init() {
 		log.Fatal(err)
 	}
 }
+
+// LoadTemplate loads a custom serializer template from a file
+func LoadTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(filepath.Base(path)).Funcs(nil).Parse(string(data))
+}
+
+// NewFieldTemplateData returns the fields of a message from the layout of its struct
+func NewFieldTemplateData(layout *nanopb.Layout) []*FieldTemplateData {
+	fields := make([]*FieldTemplateData, 0)
+	// has_ and _count members precede the member holding the value
+	companions := make(map[string]bool)
+	companion := func(name string) string {
+		if companions[name] {
+			return name
+		}
+		return ""
+	}
+	for _, m := range layout.Members {
+		if m.Field == nil {
+			continue
+		}
+		name := string(m.Field.Name())
+		switch m.Name {
+		case "has_" + name, name + "_count":
+			companions[m.Name] = true
+			continue
+		}
+		fields = append(fields, &FieldTemplateData{
+			CountMember: companion(name + "_count"),
+			CType:       m.CType,
+			HasMember:   companion("has_" + name),
+			Member:      m.Name,
+			Name:        name,
+			Number:      int32(m.Field.Number()),
+			Offset:      m.Offset,
+			Size:        m.Size,
+		})
+	}
+	return fields
+}
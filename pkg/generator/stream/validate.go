@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+var (
+	requiredExports = []string{"jbpf_io_serialize", "jbpf_io_deserialize"}
+)
+
+// validateExports checks that a serializer library exports the functions jbpf requires
+func validateExports(soFile string) error {
+	f, err := elf.Open(soFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	symbols, err := f.DynamicSymbols()
+	if err != nil {
+		return err
+	}
+
+	exported := make(map[string]bool)
+	for _, sym := range symbols {
+		if sym.Section != elf.SHN_UNDEF && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && elf.ST_BIND(sym.Info) != elf.STB_LOCAL {
+			exported[sym.Name] = true
+		}
+	}
+
+	for _, name := range requiredExports {
+		if !exported[name] {
+			return fmt.Errorf("%s does not export %s, check the serializer template", soFile, name)
+		}
+	}
+
+	return nil
+}
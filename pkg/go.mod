@@ -3,6 +3,8 @@ module jbpf_protobuf_cli
 go 1.23
 
 require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/bufbuild/protocompile v0.14.1
 	github.com/google/uuid v1.6.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.9.1
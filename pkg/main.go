@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"jbpf_protobuf_cli/cmd/config"
 	"jbpf_protobuf_cli/cmd/decoder"
 	"jbpf_protobuf_cli/cmd/input"
 	"jbpf_protobuf_cli/cmd/serde"
@@ -26,6 +27,7 @@ func cli() *cobra.Command {
 	}
 	opts := common.NewGeneralOptions(cmd.PersistentFlags())
 	cmd.AddCommand(
+		config.Command(opts),
 		decoder.Command(opts),
 		input.Command(opts),
 		serde.Command(opts),
@@ -5,12 +5,14 @@ package schema
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/google/uuid"
@@ -44,101 +46,117 @@ func NewClient(ctx context.Context, logger *logrus.Logger, opts *Options) (*Clie
 	}, nil
 }
 
-func (c *Client) doPost(relativePath string, input interface{}) error {
-	jsonData, err := json.Marshal(input)
-	if err != nil {
-		return err
+// StatusError is returned when the decoder responds with a status code other than 2xx
+type StatusError struct {
+	Body       string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
 	}
+	return fmt.Sprintf("unexpected status code: %d: %s", e.StatusCode, e.Body)
+}
 
-	var req *http.Request
-	req, err = http.NewRequest(http.MethodPost, fmt.Sprintf("%s%s", c.baseURL, relativePath), bytes.NewReader(jsonData))
+func (c *Client) do(method, relativePath string, body io.Reader) (string, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.baseURL, relativePath), body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	resp, err := c.inner.Do(req)
 	if err != nil {
 		c.logger.WithError(err).Error("http request failed")
-		return err
+		return "", err
 	}
+	defer resp.Body.Close()
 
 	buf := new(strings.Builder)
 	_, err = io.Copy(buf, resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := &StatusError{Body: buf.String(), StatusCode: resp.StatusCode}
 		c.logger.WithField("body", buf.String()).WithError(err).Error("unexpected status code")
-		return err
+		return "", err
 	}
 
-	return nil
+	return buf.String(), nil
 }
 
-func (c *Client) doDelete(relativePath string) error {
-	var req *http.Request
-	var err error
-	req, err = http.NewRequest(http.MethodDelete, fmt.Sprintf("%s%s", c.baseURL, relativePath), nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.inner.Do(req)
+func (c *Client) doPost(relativePath string, input interface{}) error {
+	jsonData, err := json.Marshal(input)
 	if err != nil {
-		c.logger.WithError(err).Error("http request failed")
 		return err
 	}
 
-	buf := new(strings.Builder)
-	_, err = io.Copy(buf, resp.Body)
-	if err != nil {
-		return err
-	}
+	_, err = c.do(http.MethodPost, relativePath, bytes.NewReader(jsonData))
+	return err
+}
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		c.logger.WithField("body", buf.String()).WithError(err).Error("unexpected status code")
-		return err
-	}
+func (c *Client) doDelete(relativePath string) (string, error) {
+	return c.do(http.MethodDelete, relativePath, nil)
+}
 
-	return nil
+// LoadStream is a stream to associate with a message of the schema of a LoadRequest
+type LoadStream struct {
+	CodeletName  string
+	ProtoMessage string
 }
 
 // LoadRequest is a request to load a schema and stream
 type LoadRequest struct {
 	CompiledProto []byte
-	Streams       map[uuid.UUID]string
+	// RejectIncompatible refuses the load if it makes breaking changes to a schema of streams already associated
+	RejectIncompatible bool
+	Streams            map[uuid.UUID]*LoadStream
 }
 
-// Load loads the schemas into the decoder
+// Load loads the schemas into the decoder one by one, for streams which do not belong to a codeletset, see
+// LoadCodeletset otherwise. The schemas are keyed by the path they were loaded from, which is only used for reporting,
+// the decoder identifies each proto package by its descriptor, see PackageID.
 func (c *Client) Load(schemas map[string]*LoadRequest) error {
 	errs := make([]error, 0, len(schemas))
 
-	for protoPackageName, req := range schemas {
-		l := c.logger.WithFields(logrus.Fields{"pkg": protoPackageName})
+	for packagePath, req := range schemas {
+		protoPackage, err := PackageIDFromDescriptor(req.CompiledProto)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to interpret %s: %w", packagePath, err))
+			continue
+		}
+		l := c.logger.WithFields(logrus.Fields{"packagePath": packagePath, "protoPackage": protoPackage})
 
-		if err := c.doPost("/schema", &UpsertSchemaRequest{ProtoDescriptor: req.CompiledProto}); err != nil {
-			err = fmt.Errorf("failed to upsert proto package %s: %w", protoPackageName, err)
+		if err := c.doPost("/schema", &UpsertSchemaRequest{ProtoDescriptor: req.CompiledProto, RejectIncompatible: req.RejectIncompatible}); err != nil {
+			err = fmt.Errorf("failed to upsert proto package %s from %s: %w", protoPackage, packagePath, err)
 			errs = append(errs, err)
 			continue
 		}
 
 		l.Info("successfully upserted proto package")
 
-		for streamUUID, protoMsg := range req.Streams {
-			err := c.doPost("/stream", &AddSchemaAssociationRequest{StreamUUID: streamUUID, ProtoPackage: protoPackageName, ProtoMessage: protoMsg})
+		// pin the streams to the version just upserted, in case another client upserts a newer version concurrently
+		checksum := Checksum(sha1.Sum(req.CompiledProto))
+		for streamUUID, stream := range req.Streams {
+			err := c.doPost("/stream", &AddSchemaAssociationRequest{
+				CodeletName:   stream.CodeletName,
+				ProtoChecksum: checksum.String(),
+				ProtoMessage:  stream.ProtoMessage,
+				ProtoPackage:  protoPackage,
+				StreamUUID:    streamUUID,
+			})
 			if err != nil {
-				err = fmt.Errorf("failed to associate streamID %s to proto package %s and message %s: %w", streamUUID.String(), protoPackageName, protoMsg, err)
+				err = fmt.Errorf("failed to associate streamID %s to proto package %s and message %s: %w", streamUUID.String(), protoPackage, stream.ProtoMessage, err)
 				errs = append(errs, err)
 				continue
 			}
 
 			l.WithFields(logrus.Fields{
-				"protoMsg":         protoMsg,
-				"protoPackageName": protoPackageName,
-				"streamId":         streamUUID.String(),
+				"codeletName": stream.CodeletName,
+				"protoMsg":    stream.ProtoMessage,
+				"streamId":    streamUUID.String(),
 			}).Info("successfully associated stream ID with proto package")
 		}
 	}
@@ -146,6 +164,59 @@ func (c *Client) Load(schemas map[string]*LoadRequest) error {
 	return errors.Join(errs...)
 }
 
+// LoadCodeletset loads the proto packages and stream associations of a codeletset into the decoder, all together or
+// not at all
+func (c *Client) LoadCodeletset(req *LoadCodeletsetRequest) error {
+	l := c.logger.WithField("codeletsetID", req.CodeletsetID)
+
+	if err := c.doPost("/codeletset", req); err != nil {
+		return fmt.Errorf("failed to load codeletset %s: %w", req.CodeletsetID, err)
+	}
+
+	for _, stream := range req.Streams {
+		l.WithFields(logrus.Fields{
+			"protoMsg":     stream.ProtoMessage,
+			"protoPackage": stream.ProtoPackage,
+			"streamId":     stream.StreamUUID.String(),
+		}).Info("successfully associated stream ID with proto package")
+	}
+	l.Info("successfully loaded codeletset")
+
+	return nil
+}
+
+// UnloadCodeletset removes what loading a codeletset added to the decoder. It returns a StatusError with
+// http.StatusNotFound if the codeletset is not loaded.
+func (c *Client) UnloadCodeletset(codeletsetID string) error {
+	if _, err := c.doDelete("/codeletset/" + url.PathEscape(codeletsetID)); err != nil {
+		return fmt.Errorf("failed to unload codeletset %s: %w", codeletsetID, err)
+	}
+
+	c.logger.WithField("codeletsetID", codeletsetID).Info("successfully unloaded codeletset")
+
+	return nil
+}
+
+// Status returns the stream associations of the decoder grouped by codeletset, only those of a codeletset if an ID is
+// given
+func (c *Client) Status(codeletsetID string) (*StatusResponse, error) {
+	path := "/status"
+	if len(codeletsetID) > 0 {
+		path += "?" + url.Values{"codeletset": []string{codeletsetID}}.Encode()
+	}
+
+	body, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get decoder status: %w", err)
+	}
+
+	var resp StatusResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // SendControl dispatches a control message to the decoder
 func (c *Client) SendControl(streamUUID uuid.UUID, jdata string) error {
 	if err := c.doPost("/control", &SendControlRequest{StreamUUID: streamUUID, Payload: jdata}); err != nil {
@@ -165,7 +236,7 @@ func (c *Client) Unload(streamUUIDs []uuid.UUID) error {
 	for _, streamUUID := range streamUUIDs {
 		// using base64.RawURLEncoding to encode the streamUUID to a URL-safe string
 		streamIDStr := base64.RawURLEncoding.EncodeToString(streamUUID[:])
-		if err := c.doDelete(fmt.Sprintf("/stream?stream_uuid=%s", streamIDStr)); err != nil {
+		if _, err := c.doDelete(fmt.Sprintf("/stream?stream_uuid=%s", streamIDStr)); err != nil {
 			err = fmt.Errorf("failed to delete stream ID association %s: %w", streamUUID.String(), err)
 			errs = append(errs, err)
 			continue
@@ -178,3 +249,48 @@ func (c *Client) Unload(streamUUIDs []uuid.UUID) error {
 
 	return errors.Join(errs...)
 }
+
+// DeleteSchemas removes proto packages from the decoder, along with the streams still associated with them if cascade
+// is set. A package which is not loaded is skipped.
+func (c *Client) DeleteSchemas(protoPackages []string, cascade bool) error {
+	errs := make([]error, 0, len(protoPackages))
+	for _, protoPackage := range protoPackages {
+		l := c.logger.WithField("protoPackage", protoPackage)
+		query := url.Values{"pkg": []string{protoPackage}}
+		if cascade {
+			query.Set("cascade", "true")
+		}
+
+		_, err := c.doDelete("/schema?" + query.Encode())
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			l.Warn("proto package is not loaded")
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to delete proto package %s: %w", protoPackage, err))
+		default:
+			l.Info("successfully deleted proto package")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PruneSchemas removes every proto package which no stream is associated with from the decoder, returning the removed
+// packages
+func (c *Client) PruneSchemas() ([]string, error) {
+	body, err := c.doDelete("/schema?prune=true")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune proto packages: %w", err)
+	}
+
+	var resp PruneSchemasResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil, err
+	}
+	for _, protoPackage := range resp.ProtoPackages {
+		c.logger.WithField("protoPackage", protoPackage).Info("pruned proto package")
+	}
+
+	return resp.ProtoPackages, nil
+}
@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha1"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadTagsStreams loads schemas through the client into a server, and checks the streams of configs without a
+// codeletset are tagged with their codelet
+func TestLoadTagsStreams(t *testing.T) {
+	ctx := context.Background()
+	s := NewServer(ctx, logrus.New(), &Options{}, NewStore())
+
+	var mu sync.Mutex
+	associations := make([]*AddSchemaAssociationRequest, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var err error
+		switch r.URL.Path {
+		case "/schema":
+			var req UpsertSchemaRequest
+			if req, err = readBodyAs[UpsertSchemaRequest](r); err == nil {
+				err = s.UpsertProtoPackage(r.Context(), &req)
+			}
+		case "/stream":
+			var req AddSchemaAssociationRequest
+			if req, err = readBodyAs[AddSchemaAssociationRequest](r); err == nil {
+				associations = append(associations, &req)
+				err = s.AddStreamToSchemaAssociation(r.Context(), &req)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+		}
+	}))
+	defer srv.Close()
+	client := &Client{baseURL: srv.URL, ctx: ctx, inner: srv.Client(), logger: logrus.New()}
+
+	descriptor := compileSource(t, baseProto)
+	tagged, untagged := uuid.New(), uuid.New()
+	require.NoError(t, client.Load(map[string]*LoadRequest{"pkg.pb": {
+		CompiledProto: descriptor,
+		Streams: map[uuid.UUID]*LoadStream{
+			tagged:   {CodeletName: "a", ProtoMessage: "pkg.msg"},
+			untagged: {ProtoMessage: "pkg.inner"},
+		},
+	}}))
+
+	require.Len(t, associations, 2)
+	for _, req := range associations {
+		assert.Equal(t, Checksum(sha1.Sum(descriptor)).String(), req.ProtoChecksum)
+		assert.Empty(t, req.CodeletsetID)
+	}
+
+	status, err := s.Status(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, status.Codeletsets, 1)
+	codeletNames := make(map[uuid.UUID]string)
+	for _, stream := range status.Codeletsets[0].Streams {
+		codeletNames[stream.StreamUUID] = stream.CodeletName
+	}
+	assert.Equal(t, map[uuid.UUID]string{tagged: "a", untagged: ""}, codeletNames)
+
+	// loading again tags streams loaded before without a codelet name
+	require.NoError(t, client.Load(map[string]*LoadRequest{"pkg.pb": {
+		CompiledProto: descriptor,
+		Streams:       map[uuid.UUID]*LoadStream{untagged: {CodeletName: "b", ProtoMessage: "pkg.inner"}},
+	}}))
+	status, err = s.Status(ctx, "")
+	require.NoError(t, err)
+	for _, stream := range status.Codeletsets[0].Streams {
+		if stream.StreamUUID == untagged {
+			assert.Equal(t, "b", stream.CodeletName)
+		}
+	}
+}
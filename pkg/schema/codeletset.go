@@ -0,0 +1,367 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ErrCodeletsetNotFound is returned when unloading a codeletset which is not loaded
+var ErrCodeletsetNotFound = errors.New("codeletset not found")
+
+// RecordedCodeletset is what loading a codeletset added to the store besides its stream associations, which are tagged
+// with the codeletset, so that unloading it removes exactly that
+type RecordedCodeletset struct {
+	packages map[string]*codeletsetPackage
+}
+
+// codeletsetPackage is a proto package upserted by a codeletset
+type codeletsetPackage struct {
+	// added is set when the codeletset stored the package, which did not exist before
+	added    bool
+	checksum Checksum
+	// previous is the latest version of the package before the codeletset upserted a new one, if it did
+	previous *Checksum
+}
+
+// LoadCodeletset upserts the proto packages of a codeletset and associates its streams, all together or not at all.
+// Every package and association is checked before the store is modified, and every problem found is reported. Loading
+// a codeletset which is already loaded replaces it: its streams which are not in the request are removed, as are the
+// packages it added which are no longer used, so loading the same codeletset again changes nothing.
+func (s *Server) LoadCodeletset(_ context.Context, req *LoadCodeletsetRequest) error {
+	l := s.logger.WithField("codeletsetID", req.CodeletsetID)
+
+	if len(req.CodeletsetID) == 0 {
+		err := errors.New("expected a codeletset ID")
+		l.WithError(err).Error("error loading codeletset")
+		return err
+	}
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	staged, errs := s.stageProtoPackages(req.ProtoPackages)
+	checksums, streamErrs := s.stageStreams(req.CodeletsetID, req.Streams, staged)
+	if err := errors.Join(append(errs, streamErrs...)...); err != nil {
+		err = fmt.Errorf("invalid codeletset %s: %w", req.CodeletsetID, err)
+		l.WithError(err).Error("refusing to load codeletset")
+		return err
+	}
+
+	previous, ok := s.store.codeletsets[req.CodeletsetID]
+	if !ok {
+		previous = &RecordedCodeletset{}
+	}
+	recorded := &RecordedCodeletset{packages: make(map[string]*codeletsetPackage, len(staged))}
+	protoPackages := make(map[string]bool)
+
+	for _, protoPackage := range sortedKeys(staged) {
+		parsed := staged[protoPackage].parsed
+		pl := l.WithFields(logrus.Fields{"protoPackage": protoPackage, "checksum": parsed.checksum.String()})
+		// a package the codeletset already upserted keeps recording the state from before the codeletset was loaded
+		recordedPkg := &codeletsetPackage{checksum: parsed.checksum}
+		if before, ok := previous.packages[protoPackage]; ok {
+			recordedPkg.added, recordedPkg.previous = before.added, before.previous
+		}
+
+		pkg, ok := s.store.schemas[protoPackage]
+		if !ok {
+			pkg = &RecordedProtoPackage{path: parsed.path, versions: make(map[Checksum]*RecordedProtoDescriptor)}
+			s.store.schemas[protoPackage] = pkg
+			recordedPkg.added = true
+			pl.Info("setting proto package")
+		} else if pkg.latest != parsed.checksum {
+			if !recordedPkg.added && recordedPkg.previous == nil {
+				latest := pkg.latest
+				recordedPkg.previous = &latest
+			}
+			pl.Info("adding version of proto package")
+		}
+		if _, ok := pkg.versions[parsed.checksum]; !ok {
+			pkg.versions[parsed.checksum] = &RecordedProtoDescriptor{
+				checksum:        parsed.checksum,
+				files:           parsed.files,
+				ProtoDescriptor: staged[protoPackage].protoDescriptor,
+			}
+		}
+		pkg.latest = parsed.checksum
+		recorded.packages[protoPackage] = recordedPkg
+		protoPackages[protoPackage] = true
+	}
+
+	// streams of the codeletset which are not in the request are removed
+	for _, streamUUID := range s.store.streamsOfCodeletset(req.CodeletsetID) {
+		if _, ok := checksums[streamUUID]; !ok {
+			protoPackages[s.store.streamToSchema[streamUUID].ProtoPackage] = true
+			delete(s.store.streamToSchema, streamUUID)
+			l.WithField("streamUUID", streamUUID.String()).Info("association removed")
+		}
+	}
+
+	for _, stream := range req.Streams {
+		sl := l.WithFields(logrus.Fields{
+			"codeletName":  stream.CodeletName,
+			"protoMsg":     stream.ProtoMessage,
+			"protoPackage": stream.ProtoPackage,
+			"streamUUID":   stream.StreamUUID.String(),
+		})
+		checksum := checksums[stream.StreamUUID]
+
+		// an existing association is updated in place, keeping its counters
+		if current, ok := s.store.streamToSchema[stream.StreamUUID]; ok {
+			if current.checksum == checksum && current.CodeletName == stream.CodeletName && current.CodeletsetID == req.CodeletsetID &&
+				current.ProtoMsg == stream.ProtoMessage && current.ProtoPackage == stream.ProtoPackage {
+				continue
+			}
+			protoPackages[current.ProtoPackage] = true
+			current.checksum = checksum
+			current.CodeletName = stream.CodeletName
+			current.CodeletsetID = req.CodeletsetID
+			current.ProtoMsg = stream.ProtoMessage
+			current.ProtoPackage = stream.ProtoPackage
+			sl.Info("association updated")
+			continue
+		}
+
+		s.store.streamToSchema[stream.StreamUUID] = &RecordedStreamToSchema{
+			checksum:     checksum,
+			CodeletName:  stream.CodeletName,
+			CodeletsetID: req.CodeletsetID,
+			ProtoMsg:     stream.ProtoMessage,
+			ProtoPackage: stream.ProtoPackage,
+		}
+		sl.Info("association added")
+	}
+
+	// packages the codeletset no longer upserts are released as if it was unloaded
+	for _, protoPackage := range sortedKeys(previous.packages) {
+		if _, ok := recorded.packages[protoPackage]; !ok {
+			s.releaseProtoPackage(l.WithField("protoPackage", protoPackage), protoPackage, previous.packages[protoPackage])
+			protoPackages[protoPackage] = true
+		}
+	}
+
+	for _, protoPackage := range sortedKeys(protoPackages) {
+		s.collectVersions(l.WithField("protoPackage", protoPackage), protoPackage)
+	}
+
+	s.store.codeletsets[req.CodeletsetID] = recorded
+	l.Info("codeletset loaded")
+
+	return nil
+}
+
+// stagedProtoPackage is a proto package of a codeletset which has been checked but not stored yet
+type stagedProtoPackage struct {
+	parsed          *parsedProtoPackage
+	protoDescriptor []byte
+}
+
+// stageProtoPackages checks the proto packages of a codeletset could be upserted. The caller must hold the lock.
+func (s *Server) stageProtoPackages(reqs []*UpsertSchemaRequest) (map[string]*stagedProtoPackage, []error) {
+	staged := make(map[string]*stagedProtoPackage, len(reqs))
+	errs := make([]error, 0)
+
+	for _, req := range reqs {
+		parsed, err := parseProtoPackage(req.ProtoDescriptor)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to interpret proto descriptor: %w", err))
+			continue
+		}
+		protoPackage := parsed.protoPackage
+
+		if other, ok := staged[protoPackage]; ok {
+			if other.parsed.checksum != parsed.checksum {
+				errs = append(errs, fmt.Errorf("proto package %s is given more than once, with different descriptors", protoPackage))
+			}
+			continue
+		}
+
+		if pkg, ok := s.store.schemas[protoPackage]; !ok {
+			if err := s.store.checkConflicts(protoPackage, parsed.fd); err != nil {
+				errs = append(errs, err)
+			}
+		} else if req.RejectIncompatible && pkg.latest != parsed.checksum {
+			if err := s.checkCompatible(protoPackage, pkg, parsed.files); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		// packages of the same codeletset must not conflict with each other either
+		for _, other := range sortedKeys(staged) {
+			if names := conflictingNames(parsed.fd, staged[other].parsed.fd); len(names) > 0 {
+				errs = append(errs, &PackageConflictError{ConflictingPackage: other, Names: names, ProtoPackage: protoPackage})
+			}
+		}
+
+		staged[protoPackage] = &stagedProtoPackage{parsed: parsed, protoDescriptor: req.ProtoDescriptor}
+	}
+
+	return staged, errs
+}
+
+// stageStreams checks the stream associations of a codeletset could be added once its proto packages are staged,
+// returning the version of its package each stream would be pinned to. A stream may already be associated with any
+// message by the codeletset itself, which the request replaces, or with the same message by a request without a
+// codeletset, which the codeletset then takes over. Streams of other codeletsets are refused. The caller must hold the
+// lock.
+func (s *Server) stageStreams(codeletsetID string, reqs []*AddSchemaAssociationRequest, staged map[string]*stagedProtoPackage) (map[uuid.UUID]Checksum, []error) {
+	checksums := make(map[uuid.UUID]Checksum, len(reqs))
+	seen := make(map[uuid.UUID]bool, len(reqs))
+	errs := make([]error, 0)
+
+	for _, req := range reqs {
+		if seen[req.StreamUUID] {
+			errs = append(errs, fmt.Errorf("stream %s is given more than once", req.StreamUUID))
+			continue
+		}
+		seen[req.StreamUUID] = true
+		if current, ok := s.store.streamToSchema[req.StreamUUID]; ok && current.CodeletsetID != codeletsetID {
+			if len(current.CodeletsetID) > 0 {
+				errs = append(errs, fmt.Errorf("stream %s belongs to codeletset %s, unload it first", req.StreamUUID, current.CodeletsetID))
+				continue
+			}
+			if current.ProtoMsg != req.ProtoMessage || current.ProtoPackage != req.ProtoPackage {
+				errs = append(errs, fmt.Errorf("stream %s is already associated with %s in proto package %s", req.StreamUUID, current.ProtoMsg, current.ProtoPackage))
+				continue
+			}
+		}
+
+		var checksum Checksum
+		var desc *RecordedProtoDescriptor
+		if pkg, ok := staged[req.ProtoPackage]; ok {
+			checksum = pkg.parsed.checksum
+			desc = &RecordedProtoDescriptor{checksum: checksum, files: pkg.parsed.files}
+			if len(req.ProtoChecksum) > 0 && req.ProtoChecksum != checksum.String() {
+				errs = append(errs, fmt.Errorf("stream %s: version %s of proto package %s is not the one given", req.StreamUUID, req.ProtoChecksum, req.ProtoPackage))
+				continue
+			}
+		} else if pkg, ok := s.store.schemas[req.ProtoPackage]; ok {
+			checksum = pkg.latest
+			if len(req.ProtoChecksum) > 0 {
+				var err error
+				if checksum, err = ParseChecksum(req.ProtoChecksum); err != nil {
+					errs = append(errs, fmt.Errorf("stream %s: %w", req.StreamUUID, err))
+					continue
+				}
+			}
+			if desc, ok = pkg.versions[checksum]; !ok {
+				errs = append(errs, fmt.Errorf("stream %s: version %s of proto package %s not found", req.StreamUUID, checksum, req.ProtoPackage))
+				continue
+			}
+		} else {
+			errs = append(errs, fmt.Errorf("stream %s: proto package %s not found", req.StreamUUID, req.ProtoPackage))
+			continue
+		}
+
+		if d, err := desc.files.FindDescriptorByName(protoreflect.FullName(req.ProtoMessage)); err != nil {
+			errs = append(errs, fmt.Errorf("stream %s: message %s not found in proto package %s", req.StreamUUID, req.ProtoMessage, req.ProtoPackage))
+			continue
+		} else if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			errs = append(errs, fmt.Errorf("stream %s: %s in proto package %s is not a message", req.StreamUUID, req.ProtoMessage, req.ProtoPackage))
+			continue
+		}
+
+		checksums[req.StreamUUID] = checksum
+	}
+
+	return checksums, errs
+}
+
+// UnloadCodeletset removes what loading a codeletset added: its stream associations, the proto packages it added
+// which no other stream uses, and the versions it upserted, reverting the latest version of a package to the one
+// before if it is still stored. Every association tagged with the codeletset is removed, so a codeletset whose streams
+// were associated one by one can be unloaded too, while packages changed by other requests since are left alone.
+func (s *Server) UnloadCodeletset(_ context.Context, codeletsetID string) error {
+	l := s.logger.WithField("codeletsetID", codeletsetID)
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	recorded, ok := s.store.codeletsets[codeletsetID]
+	tagged := s.store.streamsOfCodeletset(codeletsetID)
+	if !ok && len(tagged) == 0 {
+		err := fmt.Errorf("%w: %s", ErrCodeletsetNotFound, codeletsetID)
+		l.WithError(err).Error("error unloading codeletset")
+		return err
+	}
+	if !ok {
+		recorded = &RecordedCodeletset{}
+	}
+
+	protoPackages := make(map[string]bool)
+	for _, streamUUID := range tagged {
+		protoPackages[s.store.streamToSchema[streamUUID].ProtoPackage] = true
+		delete(s.store.streamToSchema, streamUUID)
+		l.WithField("streamUUID", streamUUID.String()).Info("association removed")
+	}
+
+	for _, protoPackage := range sortedKeys(recorded.packages) {
+		s.releaseProtoPackage(l.WithField("protoPackage", protoPackage), protoPackage, recorded.packages[protoPackage])
+		protoPackages[protoPackage] = true
+	}
+	for _, protoPackage := range sortedKeys(protoPackages) {
+		s.collectVersions(l.WithField("protoPackage", protoPackage), protoPackage)
+	}
+
+	delete(s.store.codeletsets, codeletsetID)
+	l.Info("codeletset unloaded")
+
+	return nil
+}
+
+// releaseProtoPackage undoes the upsert of a proto package by a codeletset: the package is removed if the codeletset
+// added it and no stream uses it, otherwise its latest version reverts to the one before the codeletset upserted its
+// own, unless another version was upserted since. The caller must hold the lock and collect versions afterwards.
+func (s *Server) releaseProtoPackage(l *logrus.Entry, protoPackage string, recordedPkg *codeletsetPackage) {
+	pkg, ok := s.store.schemas[protoPackage]
+	if !ok {
+		return
+	}
+
+	switch {
+	case recordedPkg.added && len(s.store.streamsOf(protoPackage)) == 0:
+		delete(s.store.schemas, protoPackage)
+		l.Info("proto package removed")
+	case recordedPkg.added:
+		l.Warn("keeping proto package still associated with streams")
+	case recordedPkg.previous != nil && pkg.latest == recordedPkg.checksum:
+		if _, ok := pkg.versions[*recordedPkg.previous]; ok {
+			pkg.latest = *recordedPkg.previous
+			l.WithField("checksum", pkg.latest.String()).Info("reverted to previous version of proto package")
+		}
+	}
+}
+
+// streamsOfCodeletset returns the streams tagged with a codeletset, sorted. The caller must hold the lock.
+func (s *Store) streamsOfCodeletset(codeletsetID string) []uuid.UUID {
+	streams := make([]uuid.UUID, 0)
+	if len(codeletsetID) == 0 {
+		return streams
+	}
+	for streamUUID, association := range s.streamToSchema {
+		if association.CodeletsetID == codeletsetID {
+			streams = append(streams, streamUUID)
+		}
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].String() < streams[j].String()
+	})
+	return streams
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
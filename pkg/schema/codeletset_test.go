@@ -0,0 +1,299 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCodeletsetIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	taken := uuid.New()
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "other.proto", "syntax = \"proto2\";\npackage other;\nmessage msg { optional int32 x = 1; }\n")}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: taken, ProtoPackage: "other:other.proto", ProtoMessage: "other.msg"}))
+
+	err := s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: compileSource(t, baseProto)}},
+		Streams: []*AddSchemaAssociationRequest{
+			{StreamUUID: uuid.New(), ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+			{StreamUUID: uuid.New(), ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.missing"},
+			{StreamUUID: uuid.New(), ProtoPackage: "missing", ProtoMessage: "pkg.msg"},
+			{StreamUUID: taken, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+		},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "message pkg.missing not found in proto package pkg:pkg.proto")
+	assert.ErrorContains(t, err, "proto package missing not found")
+	assert.ErrorContains(t, err, "is already associated with other.msg in proto package other:other.proto")
+
+	// nothing was applied
+	assert.Len(t, store.schemas, 1)
+	assert.Len(t, store.streamToSchema, 1)
+	assert.Empty(t, store.codeletsets)
+}
+
+func TestLoadAndUnloadCodeletset(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	v1 := compileSource(t, baseProto)
+	v2 := compileSource(t, replace(baseProto, "optional string name = 2;", "optional string label = 2;"))
+	other := compileFile(t, "other.proto", "syntax = \"proto2\";\npackage other;\nmessage msg { optional int32 x = 1; }\n")
+	existing := uuid.New()
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: existing, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+
+	streams := []uuid.UUID{uuid.New(), uuid.New()}
+	req := &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v2}, {ProtoDescriptor: other}},
+		Streams: []*AddSchemaAssociationRequest{
+			{StreamUUID: streams[0], ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+			{StreamUUID: streams[1], ProtoPackage: "other:other.proto", ProtoMessage: "other.msg"},
+		},
+	}
+	require.NoError(t, s.LoadCodeletset(ctx, req))
+	assert.Len(t, store.schemas, 2)
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 2)
+	assert.Equal(t, Checksum(sha1.Sum(v2)), store.streamToSchema[streams[0]].checksum)
+	assert.Equal(t, Checksum(sha1.Sum(v1)), store.streamToSchema[existing].checksum)
+
+	// loading the same codeletset again changes nothing
+	association := store.streamToSchema[streams[0]]
+	require.NoError(t, s.LoadCodeletset(ctx, req))
+	assert.Same(t, association, store.streamToSchema[streams[0]])
+	assert.Len(t, store.schemas, 2)
+	assert.Len(t, store.streamToSchema, 3)
+
+	// loading it with other content replaces it, releasing the package it no longer uses
+	replaced := uuid.New()
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v2}},
+		Streams: []*AddSchemaAssociationRequest{
+			{StreamUUID: streams[0], ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.inner"},
+			{StreamUUID: replaced, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+		},
+	}))
+	assert.Same(t, association, store.streamToSchema[streams[0]])
+	assert.Equal(t, "pkg.inner", association.ProtoMsg)
+	assert.NotContains(t, store.streamToSchema, streams[1])
+	assert.NotContains(t, store.schemas, "other:other.proto")
+	assert.Len(t, store.streamToSchema, 3)
+
+	// streams associated without a codeletset can only be taken over with the same message
+	err := s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID: "cs2",
+		Streams:      []*AddSchemaAssociationRequest{{StreamUUID: existing, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.inner"}},
+	})
+	assert.ErrorContains(t, err, "is already associated with pkg.msg")
+
+	// unloading removes the streams and package the codeletset added and reverts the version it upserted
+	require.NoError(t, s.UnloadCodeletset(ctx, "cs"))
+	assert.Len(t, store.schemas, 1)
+	assert.Len(t, store.streamToSchema, 1)
+	assert.Contains(t, store.streamToSchema, existing)
+	assert.Equal(t, Checksum(sha1.Sum(v1)), store.schemas["pkg:pkg.proto"].latest)
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 1)
+	assert.Empty(t, store.codeletsets)
+
+	assert.ErrorIs(t, s.UnloadCodeletset(ctx, "cs"), ErrCodeletsetNotFound)
+}
+
+func TestCodeletsetsClaimingSameStream(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	v1 := compileSource(t, baseProto)
+	v2 := compileSource(t, replace(baseProto, "optional string name = 2;", "optional string label = 2;"))
+	shared, untagged := uuid.New(), uuid.New()
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: untagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID: "cs1",
+		Streams:      []*AddSchemaAssociationRequest{{StreamUUID: shared, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg", CodeletName: "a"}},
+	}))
+	checksum := store.streamToSchema[shared].checksum
+
+	// another codeletset cannot claim the stream, even with the same message or with a new version of its package
+	for _, req := range []*LoadCodeletsetRequest{
+		{CodeletsetID: "cs2", Streams: []*AddSchemaAssociationRequest{{StreamUUID: shared, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg", CodeletName: "b"}}},
+		{CodeletsetID: "cs2", ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v2}}, Streams: []*AddSchemaAssociationRequest{{StreamUUID: shared, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}}},
+	} {
+		err := s.LoadCodeletset(ctx, req)
+		assert.ErrorContains(t, err, "stream "+shared.String()+" belongs to codeletset cs1")
+		assert.Equal(t, "cs1", store.streamToSchema[shared].CodeletsetID)
+		assert.Equal(t, "a", store.streamToSchema[shared].CodeletName)
+		assert.Equal(t, checksum, store.streamToSchema[shared].checksum)
+		assert.NotContains(t, store.codeletsets, "cs2")
+	}
+
+	// a stream associated without a codeletset is taken over
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID: "cs2",
+		Streams:      []*AddSchemaAssociationRequest{{StreamUUID: untagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}},
+	}))
+	assert.Equal(t, "cs2", store.streamToSchema[untagged].CodeletsetID)
+
+	// the stream stays with the codeletset which owns it until it is unloaded
+	status, err := s.Status(ctx, "cs1")
+	require.NoError(t, err)
+	require.Len(t, status.Codeletsets[0].Streams, 1)
+	assert.Equal(t, shared, status.Codeletsets[0].Streams[0].StreamUUID)
+	require.NoError(t, s.UnloadCodeletset(ctx, "cs1"))
+	assert.NotContains(t, store.streamToSchema, shared)
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID: "cs2",
+		Streams: []*AddSchemaAssociationRequest{
+			{StreamUUID: untagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+			{StreamUUID: shared, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"},
+		},
+	}))
+	assert.Equal(t, "cs2", store.streamToSchema[shared].CodeletsetID)
+}
+
+// storeState is a deep copy of what a store holds, to check a request left it unchanged
+type storeState struct {
+	Codeletsets    map[string]map[string]codeletsetPackage
+	Schemas        map[string]map[Checksum][]byte
+	Latest         map[string]Checksum
+	Paths          map[string]string
+	StreamToSchema map[uuid.UUID][6]string
+}
+
+func snapshotStore(store *Store) *storeState {
+	state := &storeState{
+		Codeletsets:    make(map[string]map[string]codeletsetPackage),
+		Schemas:        make(map[string]map[Checksum][]byte),
+		Latest:         make(map[string]Checksum),
+		Paths:          make(map[string]string),
+		StreamToSchema: make(map[uuid.UUID][6]string),
+	}
+	for id, cs := range store.codeletsets {
+		state.Codeletsets[id] = make(map[string]codeletsetPackage)
+		for protoPackage, pkg := range cs.packages {
+			copied := *pkg
+			if pkg.previous != nil {
+				previous := *pkg.previous
+				copied.previous = &previous
+			}
+			state.Codeletsets[id][protoPackage] = copied
+		}
+	}
+	for protoPackage, pkg := range store.schemas {
+		state.Schemas[protoPackage] = make(map[Checksum][]byte)
+		for checksum, desc := range pkg.versions {
+			state.Schemas[protoPackage][checksum] = append([]byte{}, desc.ProtoDescriptor...)
+		}
+		state.Latest[protoPackage] = pkg.latest
+		state.Paths[protoPackage] = pkg.path
+	}
+	for streamUUID, association := range store.streamToSchema {
+		state.StreamToSchema[streamUUID] = [6]string{
+			association.checksum.String(), association.CodeletName, association.CodeletsetID,
+			association.ProtoMsg, association.ProtoPackage, fmt.Sprintf("%p", association),
+		}
+	}
+	return state
+}
+
+func TestLoadCodeletsetLeavesStoreUnchangedOnStreamError(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	v1 := compileSource(t, baseProto)
+	v2 := compileSource(t, replace(baseProto, "optional string name = 2;", "optional string label = 2;"))
+	other := compileFile(t, "other.proto", "syntax = \"proto2\";\npackage other;\nmessage msg { optional int32 x = 1; }\n")
+	loaded, untagged := uuid.New(), uuid.New()
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: untagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v1}},
+		Streams:       []*AddSchemaAssociationRequest{{StreamUUID: loaded, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}},
+	}))
+	before := snapshotStore(store)
+
+	// both packages stage, a new version of a stored one and a new one, but the last stream does not
+	err := s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v2}, {ProtoDescriptor: other}},
+		Streams: []*AddSchemaAssociationRequest{
+			{StreamUUID: loaded, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.inner"},
+			{StreamUUID: uuid.New(), ProtoPackage: "other:other.proto", ProtoMessage: "other.msg"},
+			{StreamUUID: untagged, ProtoPackage: "other:other.proto", ProtoMessage: "other.msg"},
+		},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "stream "+untagged.String()+" is already associated with pkg.msg")
+	assert.Equal(t, before, snapshotStore(store))
+}
+
+func TestCodeletsetStatus(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	loaded, tagged, untagged := uuid.New(), uuid.New(), uuid.New()
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: compileSource(t, baseProto)}},
+		Streams:       []*AddSchemaAssociationRequest{{StreamUUID: loaded, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg", CodeletName: "a"}},
+	}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: tagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.inner", CodeletName: "b", CodeletsetID: "other"}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: untagged, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.inner"}))
+
+	// pkg.msg requires an id, so an empty payload fails to decode
+	msg, err := store.Decode(loaded, []byte{0x08, 0x01})
+	require.NoError(t, err)
+	assert.Equal(t, "cs", msg.CodeletsetID)
+	assert.Equal(t, "a", msg.CodeletName)
+	_, err = store.Decode(loaded, []byte{})
+	assert.Error(t, err)
+	_, err = store.Decode(uuid.New(), []byte{})
+	assert.Error(t, err)
+
+	status, err := s.Status(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, status.Codeletsets, 3)
+	assert.Equal(t, uint64(1), status.UnknownStreamMessages)
+	assert.Equal(t, "", status.Codeletsets[0].CodeletsetID)
+	assert.Equal(t, untagged, status.Codeletsets[0].Streams[0].StreamUUID)
+	assert.Equal(t, "cs", status.Codeletsets[1].CodeletsetID)
+	assert.Equal(t, &StreamStatus{
+		CodeletName:   "a",
+		ProtoChecksum: store.schemas["pkg:pkg.proto"].latest.String(),
+		ProtoMessage:  "pkg.msg",
+		ProtoPackage:  "pkg:pkg.proto",
+		StreamUUID:    loaded,
+		Decoded:       1,
+		Failed:        1,
+	}, status.Codeletsets[1].Streams[0])
+	assert.Equal(t, "other", status.Codeletsets[2].CodeletsetID)
+
+	status, err = s.Status(ctx, "other")
+	require.NoError(t, err)
+	require.Len(t, status.Codeletsets, 1)
+	assert.Equal(t, tagged, status.Codeletsets[0].Streams[0].StreamUUID)
+	_, err = s.Status(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCodeletsetNotFound)
+
+	// streams tagged with a codeletset can be unloaded by its ID, even if it was not loaded as a whole
+	require.NoError(t, s.UnloadCodeletset(ctx, "other"))
+	assert.NotContains(t, store.streamToSchema, tagged)
+	assert.Len(t, store.streamToSchema, 2)
+	assert.ErrorIs(t, s.UnloadCodeletset(ctx, ""), ErrCodeletsetNotFound)
+}
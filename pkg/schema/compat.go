@@ -0,0 +1,288 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package schema
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Change is a difference between two versions of a proto package
+type Change struct {
+	// Breaking is true if data written with the old version can be silently mis-decoded with the new version
+	Breaking bool
+	Name     protoreflect.FullName
+	Reason   string
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s: %s", c.Name, c.Reason)
+}
+
+// HasBreakingChanges returns true if any of the changes is breaking
+func HasBreakingChanges(changes []*Change) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFiles parses a serialized FileDescriptorSet
+func ParseFiles(protoDescriptor []byte) (*protoregistry.Files, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(protoDescriptor, fds); err != nil {
+		return nil, err
+	}
+	return protodesc.NewFiles(fds)
+}
+
+// wireGroups are the scalar kinds which share an encoding, values written as one kind of a group can be read as another
+var wireGroups = map[protoreflect.Kind]int{
+	protoreflect.BoolKind:     0,
+	protoreflect.EnumKind:     0,
+	protoreflect.Int32Kind:    0,
+	protoreflect.Int64Kind:    0,
+	protoreflect.Uint32Kind:   0,
+	protoreflect.Uint64Kind:   0,
+	protoreflect.Sint32Kind:   1,
+	protoreflect.Sint64Kind:   1,
+	protoreflect.Fixed32Kind:  2,
+	protoreflect.Sfixed32Kind: 2,
+	protoreflect.Fixed64Kind:  3,
+	protoreflect.Sfixed64Kind: 3,
+	protoreflect.FloatKind:    4,
+	protoreflect.DoubleKind:   5,
+	protoreflect.BytesKind:    6,
+	protoreflect.StringKind:   6,
+}
+
+type differ struct {
+	changes []*Change
+	seen    map[protoreflect.FullName]bool
+}
+
+func (d *differ) add(breaking bool, name protoreflect.FullName, format string, args ...interface{}) {
+	d.changes = append(d.changes, &Change{Breaking: breaking, Name: name, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Diff returns the changes to every message and enum of the old version of a proto package
+func Diff(oldFiles, newFiles *protoregistry.Files) []*Change {
+	d := &differ{changes: make([]*Change, 0), seen: make(map[protoreflect.FullName]bool)}
+
+	var walkMessages func(mds protoreflect.MessageDescriptors)
+	walkEnums := func(eds protoreflect.EnumDescriptors) {
+		for i := 0; i < eds.Len(); i++ {
+			d.enum(eds.Get(i), newFiles)
+		}
+	}
+	walkMessages = func(mds protoreflect.MessageDescriptors) {
+		for i := 0; i < mds.Len(); i++ {
+			md := mds.Get(i)
+			if md.IsMapEntry() {
+				continue
+			}
+			d.message(md, newFiles)
+			walkMessages(md.Messages())
+			walkEnums(md.Enums())
+		}
+	}
+	oldFiles.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		walkMessages(fd.Messages())
+		walkEnums(fd.Enums())
+		return true
+	})
+
+	return d.sorted()
+}
+
+// DiffMessages returns the changes to the given messages of the old version of a proto package, along with any
+// messages and enums they reference
+func DiffMessages(oldFiles, newFiles *protoregistry.Files, msgNames []string) []*Change {
+	d := &differ{changes: make([]*Change, 0), seen: make(map[protoreflect.FullName]bool)}
+	for _, msgName := range msgNames {
+		name := protoreflect.FullName(msgName)
+		desc, err := oldFiles.FindDescriptorByName(name)
+		if err != nil {
+			continue
+		}
+		if md, ok := desc.(protoreflect.MessageDescriptor); ok {
+			d.message(md, newFiles)
+		}
+	}
+	return d.sorted()
+}
+
+func (d *differ) sorted() []*Change {
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		if d.changes[i].Breaking != d.changes[j].Breaking {
+			return d.changes[i].Breaking
+		}
+		return d.changes[i].Name < d.changes[j].Name
+	})
+	return d.changes
+}
+
+func (d *differ) message(oldMd protoreflect.MessageDescriptor, newFiles *protoregistry.Files) {
+	if d.seen[oldMd.FullName()] {
+		return
+	}
+	d.seen[oldMd.FullName()] = true
+
+	desc, err := newFiles.FindDescriptorByName(oldMd.FullName())
+	if err != nil {
+		d.add(true, oldMd.FullName(), "message removed")
+		return
+	}
+	newMd, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		d.add(true, oldMd.FullName(), "message replaced by a %s", descriptorKind(desc))
+		return
+	}
+
+	oldFields, newFields := oldMd.Fields(), newMd.Fields()
+	for i := 0; i < oldFields.Len(); i++ {
+		oldFd := oldFields.Get(i)
+		newFd := newFields.ByNumber(oldFd.Number())
+		if newFd == nil {
+			if newMd.ReservedRanges().Has(oldFd.Number()) {
+				d.add(false, oldFd.FullName(), "field %d removed and reserved", oldFd.Number())
+			} else {
+				d.add(false, oldFd.FullName(), "field %d removed without reserving its number", oldFd.Number())
+			}
+			continue
+		}
+		d.field(oldFd, newFd, newFiles)
+	}
+
+	for i := 0; i < newFields.Len(); i++ {
+		newFd := newFields.Get(i)
+		if oldFields.ByNumber(newFd.Number()) != nil {
+			continue
+		}
+		if oldMd.ReservedRanges().Has(newFd.Number()) {
+			d.add(true, newFd.FullName(), "field number %d was reserved", newFd.Number())
+		} else if newFd.Cardinality() == protoreflect.Required {
+			d.add(true, newFd.FullName(), "required field %d added, data without it fails to decode", newFd.Number())
+		} else {
+			d.add(false, newFd.FullName(), "field %d added", newFd.Number())
+		}
+	}
+}
+
+func (d *differ) field(oldFd, newFd protoreflect.FieldDescriptor, newFiles *protoregistry.Files) {
+	if oldFd.Name() != newFd.Name() {
+		d.add(true, newFd.FullName(), "field number %d reused, was %s", newFd.Number(), oldFd.Name())
+	}
+
+	switch {
+	case oldFd.IsMap() != newFd.IsMap():
+		d.add(true, newFd.FullName(), "changed between map and non-map field")
+		return
+	case oldFd.IsMap():
+		d.field(oldFd.MapKey(), newFd.MapKey(), newFiles)
+		d.field(oldFd.MapValue(), newFd.MapValue(), newFiles)
+		return
+	}
+
+	oldCard, newCard := oldFd.Cardinality(), newFd.Cardinality()
+	switch {
+	case oldCard == newCard:
+	case oldCard == protoreflect.Repeated || newCard == protoreflect.Repeated:
+		d.add(true, newFd.FullName(), "cardinality changed from %s to %s", oldCard, newCard)
+	case oldCard == protoreflect.Required || newCard == protoreflect.Required:
+		d.add(true, newFd.FullName(), "cardinality changed from %s to %s, data without the field fails to decode", oldCard, newCard)
+	default:
+		d.add(false, newFd.FullName(), "cardinality changed from %s to %s", oldCard, newCard)
+	}
+
+	oldKind, newKind := oldFd.Kind(), newFd.Kind()
+	if oldKind == protoreflect.GroupKind {
+		oldKind = protoreflect.MessageKind
+	}
+	if newKind == protoreflect.GroupKind {
+		newKind = protoreflect.MessageKind
+	}
+	switch {
+	case oldKind == protoreflect.MessageKind && newKind == protoreflect.MessageKind:
+		if oldFd.Message().FullName() != newFd.Message().FullName() {
+			d.add(true, newFd.FullName(), "type changed from %s to %s", oldFd.Message().FullName(), newFd.Message().FullName())
+			return
+		}
+		d.message(oldFd.Message(), newFiles)
+	case oldKind == newKind:
+		if oldKind == protoreflect.EnumKind {
+			if oldFd.Enum().FullName() != newFd.Enum().FullName() {
+				d.add(true, newFd.FullName(), "type changed from %s to %s", oldFd.Enum().FullName(), newFd.Enum().FullName())
+				return
+			}
+			d.enum(oldFd.Enum(), newFiles)
+		}
+	case oldKind == protoreflect.MessageKind || newKind == protoreflect.MessageKind:
+		d.add(true, newFd.FullName(), "type changed from %s to %s", oldKind, newKind)
+	case wireGroups[oldKind] == wireGroups[newKind]:
+		d.add(false, newFd.FullName(), "type changed from %s to %s, which is wire compatible but values may be truncated", oldKind, newKind)
+	default:
+		d.add(true, newFd.FullName(), "type changed from %s to %s", oldKind, newKind)
+	}
+}
+
+func (d *differ) enum(oldEd protoreflect.EnumDescriptor, newFiles *protoregistry.Files) {
+	if d.seen[oldEd.FullName()] {
+		return
+	}
+	d.seen[oldEd.FullName()] = true
+
+	desc, err := newFiles.FindDescriptorByName(oldEd.FullName())
+	if err != nil {
+		d.add(true, oldEd.FullName(), "enum removed")
+		return
+	}
+	newEd, ok := desc.(protoreflect.EnumDescriptor)
+	if !ok {
+		d.add(true, oldEd.FullName(), "enum replaced by a %s", descriptorKind(desc))
+		return
+	}
+
+	oldValues, newValues := oldEd.Values(), newEd.Values()
+	for i := 0; i < oldValues.Len(); i++ {
+		oldValue := oldValues.Get(i)
+		newValue := newValues.ByNumber(oldValue.Number())
+		switch {
+		case newValue == nil:
+			d.add(true, oldValue.FullName(), "enum value %d removed", oldValue.Number())
+		case newValue.Name() != oldValue.Name():
+			d.add(false, newValue.FullName(), "enum value %d renamed, was %s", oldValue.Number(), oldValue.Name())
+		}
+	}
+	for i := 0; i < newValues.Len(); i++ {
+		newValue := newValues.Get(i)
+		if oldValues.ByNumber(newValue.Number()) == nil {
+			d.add(false, newValue.FullName(), "enum value %d added", newValue.Number())
+		}
+	}
+}
+
+func descriptorKind(desc protoreflect.Descriptor) string {
+	switch desc.(type) {
+	case protoreflect.MessageDescriptor:
+		return "message"
+	case protoreflect.EnumDescriptor:
+		return "enum"
+	case protoreflect.EnumValueDescriptor:
+		return "enum value"
+	case protoreflect.FieldDescriptor:
+		return "field"
+	case protoreflect.ServiceDescriptor:
+		return "service"
+	default:
+		return fmt.Sprintf("%T", desc)
+	}
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"context"
+	"jbpf_protobuf_cli/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const baseProto = `syntax = "proto2";
+package pkg;
+enum state { GOOD = 0; BAD = 1; UNKNOWN = 2; }
+message inner { optional int32 a = 1; }
+message msg {
+  required int32 id = 1;
+  optional string name = 2;
+  optional state state = 3;
+  optional inner inner = 4;
+  optional sint32 delta = 5;
+}
+message unrelated { optional int32 x = 1; }
+`
+
+func compileSource(t *testing.T, source string) []byte {
+	return compileFile(t, "pkg.proto", source)
+}
+
+func compileFile(t *testing.T, path, source string) []byte {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, path), []byte(source), 0644))
+	fds, err := compiler.Compile(context.Background(), []string{path}, []string{dir}, false)
+	require.NoError(t, err)
+	data, err := proto.Marshal(fds)
+	require.NoError(t, err)
+	return data
+}
+
+func parseSource(t *testing.T, source string) *protoregistry.Files {
+	files, err := ParseFiles(compileSource(t, source))
+	require.NoError(t, err)
+	return files
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		source   string
+		breaking bool
+		reason   string
+	}{
+		{"unchanged", baseProto, false, ""},
+		{"field added", replace(baseProto, "optional sint32 delta = 5;", "optional sint32 delta = 5; optional int32 extra = 6;"), false, "field 6 added"},
+		{"required field added", replace(baseProto, "optional sint32 delta = 5;", "optional sint32 delta = 5; required int32 extra = 6;"), true, "required field 6 added, data without it fails to decode"},
+		{"field number reused", replace(baseProto, "optional string name = 2;", "optional string label = 2;"), true, "field number 2 reused, was name"},
+		{"type changed", replace(baseProto, "optional sint32 delta = 5;", "optional int32 delta = 5;"), true, "type changed from sint32 to int32"},
+		{"wire compatible type change", replace(baseProto, "optional sint32 delta = 5;", "optional sint64 delta = 5;"), false, "type changed from sint32 to sint64, which is wire compatible but values may be truncated"},
+		{"nested message changed", replace(baseProto, "optional int32 a = 1;", "optional string a = 1;"), true, "type changed from int32 to string"},
+		{"enum value removed", replace(baseProto, "UNKNOWN = 2;", ""), true, "enum value 2 removed"},
+		{"enum value added", replace(baseProto, "UNKNOWN = 2;", "UNKNOWN = 2; OTHER = 3;"), false, "enum value 3 added"},
+		{"field removed", replace(baseProto, "optional sint32 delta = 5;", ""), false, "field 5 removed without reserving its number"},
+		{"field removed and reserved", replace(baseProto, "optional sint32 delta = 5;", "reserved 5;"), false, "field 5 removed and reserved"},
+	}
+
+	oldFiles := parseSource(t, baseProto)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := DiffMessages(oldFiles, parseSource(t, tc.source), []string{"pkg.msg"})
+			assert.Equal(t, tc.breaking, HasBreakingChanges(changes))
+			if len(tc.reason) == 0 {
+				assert.Empty(t, changes)
+				return
+			}
+			require.Len(t, changes, 1)
+			assert.Equal(t, tc.reason, changes[0].Reason)
+		})
+	}
+}
+
+func TestDiffUnreferencedMessages(t *testing.T) {
+	oldFiles := parseSource(t, baseProto)
+	newFiles := parseSource(t, replace(baseProto, "message unrelated { optional int32 x = 1; }", ""))
+
+	assert.Empty(t, DiffMessages(oldFiles, newFiles, []string{"pkg.msg"}))
+
+	changes := Diff(oldFiles, newFiles)
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].Breaking)
+	assert.Equal(t, "pkg.unrelated: message removed", changes[0].String())
+}
+
+func TestUpsertRejectIncompatible(t *testing.T) {
+	s := NewServer(context.Background(), logrus.New(), &Options{}, NewStore())
+	require.NoError(t, s.UpsertProtoPackage(context.Background(), &UpsertSchemaRequest{ProtoDescriptor: compileSource(t, baseProto)}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(context.Background(), &AddSchemaAssociationRequest{
+		StreamUUID:   uuid.New(),
+		ProtoPackage: "pkg:pkg.proto",
+		ProtoMessage: "pkg.msg",
+	}))
+
+	compatible := compileSource(t, replace(baseProto, "UNKNOWN = 2;", "UNKNOWN = 2; OTHER = 3;"))
+	require.NoError(t, s.UpsertProtoPackage(context.Background(), &UpsertSchemaRequest{ProtoDescriptor: compatible, RejectIncompatible: true}))
+
+	incompatible := compileSource(t, replace(baseProto, "UNKNOWN = 2;", ""))
+	err := s.UpsertProtoPackage(context.Background(), &UpsertSchemaRequest{ProtoDescriptor: incompatible, RejectIncompatible: true})
+	var incompatibleErr *IncompatibleSchemaError
+	require.ErrorAs(t, err, &incompatibleErr)
+	assert.Equal(t, "pkg:pkg.proto", incompatibleErr.ProtoPackage)
+
+	require.NoError(t, s.UpsertProtoPackage(context.Background(), &UpsertSchemaRequest{ProtoDescriptor: incompatible}))
+}
+
+func replace(s, old, new string) string {
+	return strings.Replace(s, old, new, 1)
+}
@@ -12,20 +12,28 @@ import (
 // UpsertSchemaRequest is the request body for the /schema endpoint
 type UpsertSchemaRequest struct {
 	ProtoDescriptor []byte
+	// RejectIncompatible refuses to replace a stored package with one which has breaking changes to the messages of
+	// streams still associated with it
+	RejectIncompatible bool
 }
 
 // MarshalJSON marshals the UpsertSchemaRequest to JSON
 func (u UpsertSchemaRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		ProtoDescriptor string
+		ProtoDescriptor    string
+		RejectIncompatible bool
 	}{
-		ProtoDescriptor: base64.StdEncoding.EncodeToString(u.ProtoDescriptor),
+		ProtoDescriptor:    base64.StdEncoding.EncodeToString(u.ProtoDescriptor),
+		RejectIncompatible: u.RejectIncompatible,
 	})
 }
 
 // UnmarshalJSON unmarshals the UpsertSchemaRequest from JSON
 func (u *UpsertSchemaRequest) UnmarshalJSON(data []byte) error {
-	var intermediate struct{ ProtoDescriptor string }
+	var intermediate struct {
+		ProtoDescriptor    string
+		RejectIncompatible bool
+	}
 	if err := json.Unmarshal(data, &intermediate); err != nil {
 		return err
 	}
@@ -34,35 +42,64 @@ func (u *UpsertSchemaRequest) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	u.ProtoDescriptor = protoDesc
+	u.RejectIncompatible = intermediate.RejectIncompatible
 	return nil
 }
 
+// DeleteSchemaRequest is a request to delete a proto package, given as the query of a DELETE to the /schema endpoint
+type DeleteSchemaRequest struct {
+	// Cascade removes the associations of streams with the package rather than refusing the request
+	Cascade      bool
+	ProtoPackage string
+}
+
+// PruneSchemasResponse is the response body of a prune DELETE to the /schema endpoint
+type PruneSchemasResponse struct {
+	ProtoPackages []string
+}
+
 // AddSchemaAssociationRequest is the request body for the /stream endpoint
 type AddSchemaAssociationRequest struct {
 	StreamUUID   uuid.UUID
 	ProtoPackage string
 	ProtoMessage string
+	// ProtoChecksum is the base64 encoded checksum of the version of the proto package to pin the stream to, the
+	// latest version is used when empty
+	ProtoChecksum string
+	// CodeletName and CodeletsetID tag the stream with the codelet which emits it and its codeletset, both optional.
+	// The CodeletsetID of the streams of a LoadCodeletsetRequest is the codeletset's.
+	CodeletName  string
+	CodeletsetID string
 }
 
 // MarshalJSON marshals the AddSchemaAssociationRequest to JSON
 func (a AddSchemaAssociationRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		StreamUUID   string
-		ProtoPackage string
-		ProtoMessage string
+		StreamUUID    string
+		ProtoPackage  string
+		ProtoMessage  string
+		ProtoChecksum string
+		CodeletName   string
+		CodeletsetID  string
 	}{
-		StreamUUID:   a.StreamUUID.String(),
-		ProtoPackage: a.ProtoPackage,
-		ProtoMessage: a.ProtoMessage,
+		StreamUUID:    a.StreamUUID.String(),
+		ProtoPackage:  a.ProtoPackage,
+		ProtoMessage:  a.ProtoMessage,
+		ProtoChecksum: a.ProtoChecksum,
+		CodeletName:   a.CodeletName,
+		CodeletsetID:  a.CodeletsetID,
 	})
 }
 
 // UnmarshalJSON unmarshals the AddSchemaAssociationRequest from JSON
 func (a *AddSchemaAssociationRequest) UnmarshalJSON(data []byte) error {
 	var intermediate struct {
-		StreamUUID   string
-		ProtoPackage string
-		ProtoMessage string
+		StreamUUID    string
+		ProtoPackage  string
+		ProtoMessage  string
+		ProtoChecksum string
+		CodeletName   string
+		CodeletsetID  string
 	}
 	if err := json.Unmarshal(data, &intermediate); err != nil {
 		return err
@@ -74,9 +111,48 @@ func (a *AddSchemaAssociationRequest) UnmarshalJSON(data []byte) error {
 	a.StreamUUID = streamUUID
 	a.ProtoPackage = intermediate.ProtoPackage
 	a.ProtoMessage = intermediate.ProtoMessage
+	a.ProtoChecksum = intermediate.ProtoChecksum
+	a.CodeletName = intermediate.CodeletName
+	a.CodeletsetID = intermediate.CodeletsetID
 	return nil
 }
 
+// LoadCodeletsetRequest is the request body for a POST to the /codeletset endpoint. Its proto packages and stream
+// associations are applied all together or not at all.
+type LoadCodeletsetRequest struct {
+	CodeletsetID  string
+	ProtoPackages []*UpsertSchemaRequest
+	// Streams are associated with the version of a proto package given in ProtoPackages, or with a stored package
+	Streams []*AddSchemaAssociationRequest
+}
+
+// StatusResponse is the response body for the /status endpoint
+type StatusResponse struct {
+	Codeletsets []*CodeletsetStatus
+	// UnknownStreamMessages counts the messages received for streams with no schema association
+	UnknownStreamMessages uint64
+}
+
+// CodeletsetStatus is the status of the streams of a codeletset. Streams associated without a codeletset are grouped
+// under an empty CodeletsetID.
+type CodeletsetStatus struct {
+	CodeletsetID string
+	Streams      []*StreamStatus
+}
+
+// StreamStatus is the status of a stream associated with a schema
+type StreamStatus struct {
+	CodeletName   string
+	ProtoChecksum string
+	ProtoMessage  string
+	ProtoPackage  string
+	StreamUUID    uuid.UUID
+	// Decoded and Failed count the messages received for the stream since it was associated, which were and were not
+	// decoded
+	Decoded uint64
+	Failed  uint64
+}
+
 // SendControlRequest is the request body for the /control endpoint
 type SendControlRequest struct {
 	StreamUUID uuid.UUID
@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// PackageID returns the identity of the proto package described by a FileDescriptorSet. The package is the last file
+// in the set, preceded by any of its dependencies, and is identified by its proto package and the path of the file,
+// as `<package>:<path>`, or just the path if the file declares no package. The name of the serialized descriptor plays
+// no part, so renaming a .pb file does not change the identity, while files with the same name in different
+// directories do not collide.
+func PackageID(fds *descriptorpb.FileDescriptorSet) (string, error) {
+	if len(fds.File) == 0 {
+		return "", fmt.Errorf("expected at least one file descriptor in the set")
+	}
+	fd := fds.File[len(fds.File)-1]
+	if len(fd.GetPackage()) == 0 {
+		return fd.GetName(), nil
+	}
+	return fmt.Sprintf("%s:%s", fd.GetPackage(), fd.GetName()), nil
+}
+
+// PackageIDFromDescriptor returns the identity of the proto package described by a serialized FileDescriptorSet
+func PackageIDFromDescriptor(protoDescriptor []byte) (string, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(protoDescriptor, fds); err != nil {
+		return "", err
+	}
+	return PackageID(fds)
+}
+
+// PackageConflictError is returned when an upsert declares messages or enums which a proto package with a different
+// identity already declares, typically because the .proto file was moved or renamed
+type PackageConflictError struct {
+	ConflictingPackage string
+	Names              []protoreflect.FullName
+	ProtoPackage       string
+}
+
+func (e *PackageConflictError) Error() string {
+	names := make([]string, 0, len(e.Names))
+	for _, name := range e.Names {
+		names = append(names, string(name))
+	}
+	return fmt.Sprintf("proto package %s declares %s, which proto package %s already declares", e.ProtoPackage, strings.Join(names, ", "), e.ConflictingPackage)
+}
+
+// declaredNames returns the full names of the top level messages and enums declared by a file
+func declaredNames(fd protoreflect.FileDescriptor) []protoreflect.FullName {
+	names := make([]protoreflect.FullName, 0, fd.Messages().Len()+fd.Enums().Len())
+	for i := 0; i < fd.Messages().Len(); i++ {
+		names = append(names, fd.Messages().Get(i).FullName())
+	}
+	for i := 0; i < fd.Enums().Len(); i++ {
+		names = append(names, fd.Enums().Get(i).FullName())
+	}
+	return names
+}
+
+// checkConflicts checks the main file of a new proto package declares nothing declared by the main file of the latest
+// version of another stored proto package. Names declared by shared dependencies do not conflict. The caller must hold
+// the lock.
+func (s *Store) checkConflicts(protoPackage string, fd protoreflect.FileDescriptor) error {
+	others := make([]string, 0, len(s.schemas))
+	for other := range s.schemas {
+		if other != protoPackage {
+			others = append(others, other)
+		}
+	}
+	sort.Strings(others)
+
+	for _, other := range others {
+		pkg := s.schemas[other]
+		otherFd, err := pkg.versions[pkg.latest].files.FindFileByPath(pkg.path)
+		if err != nil {
+			continue
+		}
+		conflicts := conflictingNames(fd, otherFd)
+		if len(conflicts) > 0 {
+			return &PackageConflictError{ConflictingPackage: other, Names: conflicts, ProtoPackage: protoPackage}
+		}
+	}
+	return nil
+}
+
+// conflictingNames returns the names declared by the main file of a proto package which the main file of another
+// package also declares in the same proto package
+func conflictingNames(fd, otherFd protoreflect.FileDescriptor) []protoreflect.FullName {
+	conflicts := make([]protoreflect.FullName, 0)
+	if otherFd.Package() == fd.Package() {
+		for _, name := range declaredNames(fd) {
+			if otherFd.Messages().ByName(name.Name()) != nil || otherFd.Enums().ByName(name.Name()) != nil {
+				conflicts = append(conflicts, name)
+			}
+		}
+	}
+	return conflicts
+}
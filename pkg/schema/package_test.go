@@ -0,0 +1,46 @@
+package schema
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageIDFromDescriptor(t *testing.T) {
+	id, err := PackageIDFromDescriptor(compileFile(t, "a/pkg.proto", baseProto))
+	require.NoError(t, err)
+	assert.Equal(t, "pkg:a/pkg.proto", id)
+
+	id, err = PackageIDFromDescriptor(compileFile(t, "nopkg.proto", replace(baseProto, "package pkg;", "")))
+	require.NoError(t, err)
+	assert.Equal(t, "nopkg.proto", id)
+}
+
+func TestUpsertPackageIdentity(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	// files with the same name in different directories are different packages
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "a/schema.proto", "syntax = \"proto2\";\npackage a;\nmessage msg { optional int32 x = 1; }\n")}))
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "b/schema.proto", "syntax = \"proto2\";\npackage b;\nmessage msg { optional int32 x = 1; }\n")}))
+	assert.Len(t, store.schemas, 2)
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: uuid.New(), ProtoPackage: "a:a/schema.proto", ProtoMessage: "a.msg"}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: uuid.New(), ProtoPackage: "b:b/schema.proto", ProtoMessage: "b.msg"}))
+
+	// moving a file which declares the same messages conflicts with the package already stored
+	err := s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "c/schema.proto", "syntax = \"proto2\";\npackage a;\nmessage msg { optional int32 x = 1; }\nmessage other { optional int32 y = 1; }\n")})
+	var conflictErr *PackageConflictError
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, "a:a/schema.proto", conflictErr.ConflictingPackage)
+	assert.Equal(t, "proto package a:c/schema.proto declares a.msg, which proto package a:a/schema.proto already declares", err.Error())
+	assert.Len(t, store.schemas, 2)
+
+	// other files of the same proto package may declare other messages
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "a/extra.proto", "syntax = \"proto2\";\npackage a;\nmessage extra { optional int32 y = 1; }\n")}))
+	assert.Len(t, store.schemas, 3)
+}
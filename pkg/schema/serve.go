@@ -6,11 +6,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -37,16 +39,126 @@ func (s *Server) serveHTTP(ctx context.Context) error {
 				return
 			}
 			if err := s.UpsertProtoPackage(r.Context(), &body); err != nil {
+				var incompatibleErr *IncompatibleSchemaError
+				var conflictErr *PackageConflictError
+				if errors.As(err, &incompatibleErr) || errors.As(err, &conflictErr) {
+					w.WriteHeader(http.StatusConflict)
+					_, _ = w.Write([]byte(err.Error()))
+					return
+				}
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
 			w.WriteHeader(http.StatusOK)
 
+		case http.MethodDelete:
+			query := r.URL.Query()
+			if prune, _ := strconv.ParseBool(query.Get("prune")); prune {
+				data, err := json.Marshal(&PruneSchemasResponse{ProtoPackages: s.PruneProtoPackages(r.Context())})
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write(data)
+				return
+			}
+
+			cascade, _ := strconv.ParseBool(query.Get("cascade"))
+			req := &DeleteSchemaRequest{Cascade: cascade, ProtoPackage: query.Get("pkg")}
+			if len(req.ProtoPackage) == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("expected a pkg or prune query parameter"))
+				return
+			}
+			if err := s.DeleteProtoPackage(r.Context(), req); err != nil {
+				var inUseErr *PackageInUseError
+				switch {
+				case errors.As(err, &inUseErr):
+					w.WriteHeader(http.StatusConflict)
+				case errors.Is(err, ErrProtoPackageNotFound):
+					w.WriteHeader(http.StatusNotFound)
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 		}
 	})
 
+	http.HandleFunc("/codeletset", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := readBodyAs[LoadCodeletsetRequest](r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := s.LoadCodeletset(r.Context(), &body); err != nil {
+			var incompatibleErr *IncompatibleSchemaError
+			var conflictErr *PackageConflictError
+			if errors.As(err, &incompatibleErr) || errors.As(err, &conflictErr) {
+				w.WriteHeader(http.StatusConflict)
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/codeletset/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		codeletsetID := strings.TrimPrefix(r.URL.Path, "/codeletset/")
+		if err := s.UnloadCodeletset(r.Context(), codeletsetID); err != nil {
+			if errors.Is(err, ErrCodeletsetNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		resp, err := s.Status(r.Context(), r.URL.Query().Get("codeletset"))
+		if err != nil {
+			if errors.Is(err, ErrCodeletsetNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(data)
+	})
+
 	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
@@ -5,12 +5,15 @@ package schema
 import (
 	context "context"
 	"crypto/sha1"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"sort"
 	"strings"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/google/uuid"
@@ -40,72 +43,206 @@ func (s *Server) Serve() error {
 	return s.serveHTTP(s.ctx)
 }
 
-// UpsertProtoPackage registers a proto package with the server
+// UpsertProtoPackage registers a version of a proto package with the server. The version becomes the latest, which
+// new stream associations are pinned to, while streams associated with older versions continue to use them.
 func (s *Server) UpsertProtoPackage(_ context.Context, req *UpsertSchemaRequest) error {
-	checksum := sha1.Sum(req.ProtoDescriptor)
-	checksumAsString := base64.StdEncoding.EncodeToString(checksum[:])
-
-	fds := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(req.ProtoDescriptor, fds); err != nil {
-		s.logger.WithError(err).Error("unable to unmarshal proto descriptor")
+	parsed, err := parseProtoPackage(req.ProtoDescriptor)
+	if err != nil {
+		s.logger.WithField("checksum", Checksum(sha1.Sum(req.ProtoDescriptor)).String()).WithError(err).Error("unable to interpret proto descriptor")
 		return err
 	}
-
-	protoPackageFile := fds.File[0].GetName()
-	protoPackageName := strings.TrimSuffix(protoPackageFile, filepath.Ext(protoPackageFile))
+	protoPackage, checksum := parsed.protoPackage, parsed.checksum
 	l := s.logger.WithFields(logrus.Fields{
-		"protoPackageName": protoPackageName,
-		"checksum":         checksumAsString,
+		"protoPackage": protoPackage,
+		"checksum":     checksum.String(),
 	})
 
-	if len(fds.File) != 1 {
-		err := fmt.Errorf("expected exactly one file descriptor in the set, got %d", len(fds.File))
-		l.WithError(err).Error("unable to interpret proto descriptor")
-		return err
-	}
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
 
-	if current, ok := s.store.schemas[protoPackageName]; ok {
-		if current.checksum == checksum {
-			l.Info("checksum matches, skipping")
-			return nil
+	pkg, ok := s.store.schemas[protoPackage]
+	if !ok {
+		if err := s.store.checkConflicts(protoPackage, parsed.fd); err != nil {
+			l.WithError(err).Error("refusing to add proto package")
+			return err
 		}
-		l.Warn("overwriting existing proto package")
-	} else {
+		pkg = &RecordedProtoPackage{path: parsed.path, versions: make(map[Checksum]*RecordedProtoDescriptor)}
+		s.store.schemas[protoPackage] = pkg
 		l.Info("setting proto package")
+	} else if pkg.latest == checksum {
+		l.Info("checksum matches, skipping")
+		return nil
+	} else {
+		if req.RejectIncompatible {
+			if err := s.checkCompatible(protoPackage, pkg, parsed.files); err != nil {
+				l.WithError(err).Error("refusing to add version of proto package")
+				return err
+			}
+		}
+		if _, ok := pkg.versions[checksum]; ok {
+			l.Info("reverting to existing version of proto package")
+		} else {
+			l.Info("adding version of proto package")
+		}
+	}
+
+	if _, ok := pkg.versions[checksum]; !ok {
+		pkg.versions[checksum] = &RecordedProtoDescriptor{
+			checksum:        checksum,
+			files:           parsed.files,
+			ProtoDescriptor: req.ProtoDescriptor,
+		}
+	}
+	pkg.latest = checksum
+	s.collectVersions(l, protoPackage)
+
+	return nil
+}
+
+// parsedProtoPackage is a version of a proto package interpreted from its serialized FileDescriptorSet
+type parsedProtoPackage struct {
+	checksum Checksum
+	// fd is the main file of the package, which declares it
+	fd           protoreflect.FileDescriptor
+	files        *protoregistry.Files
+	path         string
+	protoPackage string
+}
+
+func parseProtoPackage(protoDescriptor []byte) (*parsedProtoPackage, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(protoDescriptor, fds); err != nil {
+		return nil, err
+	}
+	protoPackage, err := PackageID(fds)
+	if err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, err
 	}
+	path := fds.File[len(fds.File)-1].GetName()
+	fd, err := files.FindFileByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedProtoPackage{
+		checksum:     Checksum(sha1.Sum(protoDescriptor)),
+		fd:           fd,
+		files:        files,
+		path:         path,
+		protoPackage: protoPackage,
+	}, nil
+}
+
+// collectVersions removes versions of a proto package which are no longer in use. The caller must hold the write lock.
+func (s *Server) collectVersions(l *logrus.Entry, protoPackage string) {
+	for _, checksum := range s.store.collectVersions(protoPackage) {
+		l.WithField("removedChecksum", checksum.String()).Info("removed version of proto package with no associated streams")
+	}
+}
+
+// IncompatibleSchemaError is returned when an upsert would make breaking changes to messages still in use
+type IncompatibleSchemaError struct {
+	Changes      []*Change
+	ProtoPackage string
+}
+
+func (e *IncompatibleSchemaError) Error() string {
+	reasons := make([]string, 0, len(e.Changes))
+	for _, c := range e.Changes {
+		if c.Breaking {
+			reasons = append(reasons, c.String())
+		}
+	}
+	return fmt.Sprintf("proto package %s has breaking changes to messages of associated streams: %s", e.ProtoPackage, strings.Join(reasons, "; "))
+}
 
-	s.store.schemas[protoPackageName] = &RecordedProtoDescriptor{
-		checksum:        checksum,
-		ProtoDescriptor: req.ProtoDescriptor,
+// checkCompatible checks a new version of a stored proto package has no breaking changes to the messages which are
+// associated with a stream, compared to the version each stream is pinned to. The caller must hold the lock.
+func (s *Server) checkCompatible(protoPackage string, pkg *RecordedProtoPackage, newFiles *protoregistry.Files) error {
+	msgNames := make(map[Checksum][]string)
+	for _, association := range s.store.streamToSchema {
+		if association.ProtoPackage == protoPackage {
+			msgNames[association.checksum] = append(msgNames[association.checksum], association.ProtoMsg)
+		}
 	}
 
+	changes := make([]*Change, 0)
+	for checksum, names := range msgNames {
+		current, ok := pkg.versions[checksum]
+		if !ok {
+			continue
+		}
+		changes = append(changes, DiffMessages(current.files, newFiles, names)...)
+	}
+	if HasBreakingChanges(changes) {
+		return &IncompatibleSchemaError{Changes: changes, ProtoPackage: protoPackage}
+	}
 	return nil
 }
 
-// AddStreamToSchemaAssociation associates a stream with a schema
+// AddStreamToSchemaAssociation associates a stream with a version of a schema, the latest version unless a checksum
+// is given. Associating a stream which is already associated with another version of the same message moves it to
+// the new version.
 func (s *Server) AddStreamToSchemaAssociation(_ context.Context, req *AddSchemaAssociationRequest) error {
 	l := s.logger.WithFields(logrus.Fields{
+		"codeletName":  req.CodeletName,
+		"codeletsetID": req.CodeletsetID,
 		"protoMsg":     req.ProtoMessage,
 		"protoPackage": req.ProtoPackage,
 		"streamUUID":   req.StreamUUID.String(),
 	})
 
-	if current, ok := s.store.streamToSchema[req.StreamUUID]; ok {
-		if current.ProtoMsg == req.ProtoMessage && current.ProtoPackage == req.ProtoPackage {
-			return nil
-		}
-		err := fmt.Errorf("stream already has a schema association")
-		l.WithError(err).Error("error adding stream to schema association")
-		return err
-	}
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
 
-	if _, ok := s.store.schemas[req.ProtoPackage]; !ok {
+	pkg, ok := s.store.schemas[req.ProtoPackage]
+	if !ok {
 		err := fmt.Errorf("proto package %s not found", req.ProtoPackage)
 		l.WithError(err).Error("error adding stream to schema association")
 		return err
 	}
 
+	checksum := pkg.latest
+	if len(req.ProtoChecksum) > 0 {
+		var err error
+		if checksum, err = ParseChecksum(req.ProtoChecksum); err != nil {
+			l.WithError(err).Error("error adding stream to schema association")
+			return err
+		}
+		if _, ok := pkg.versions[checksum]; !ok {
+			err := fmt.Errorf("version %s of proto package %s not found", checksum, req.ProtoPackage)
+			l.WithError(err).Error("error adding stream to schema association")
+			return err
+		}
+	}
+	l = l.WithField("checksum", checksum.String())
+
+	if current, ok := s.store.streamToSchema[req.StreamUUID]; ok {
+		if current.ProtoMsg != req.ProtoMessage || current.ProtoPackage != req.ProtoPackage {
+			err := fmt.Errorf("stream already has a schema association")
+			l.WithError(err).Error("error adding stream to schema association")
+			return err
+		}
+		if current.CodeletsetID == req.CodeletsetID && current.CodeletName != req.CodeletName {
+			current.CodeletName = req.CodeletName
+			l.Info("association tagged with codelet")
+		}
+		if current.checksum == checksum {
+			return nil
+		}
+		current.checksum = checksum
+		l.Info("association moved to version")
+		s.collectVersions(l, req.ProtoPackage)
+		return nil
+	}
+
 	s.store.streamToSchema[req.StreamUUID] = &RecordedStreamToSchema{
+		checksum:     checksum,
+		CodeletName:  req.CodeletName,
+		CodeletsetID: req.CodeletsetID,
 		ProtoMsg:     req.ProtoMessage,
 		ProtoPackage: req.ProtoPackage,
 	}
@@ -119,13 +256,111 @@ func (s *Server) AddStreamToSchemaAssociation(_ context.Context, req *AddSchemaA
 func (s *Server) DeleteStreamToSchemaAssociation(_ context.Context, req uuid.UUID) {
 	l := s.logger.WithField("streamUUID", req.String())
 
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
 	if current, ok := s.store.streamToSchema[req]; !ok {
 		l.Debug("no association found for stream UUID")
 	} else {
 		delete(s.store.streamToSchema, req)
-		l.WithFields(logrus.Fields{
+		l = l.WithFields(logrus.Fields{
+			"checksum":     current.checksum.String(),
 			"protoMsg":     current.ProtoMsg,
 			"protoPackage": current.ProtoPackage,
-		}).Info("association removed")
+		})
+		l.Info("association removed")
+		s.collectVersions(l, current.ProtoPackage)
+	}
+}
+
+// ErrProtoPackageNotFound is returned when a request refers to a proto package which is not stored
+var ErrProtoPackageNotFound = errors.New("proto package not found")
+
+// PackageInUseError is returned when deleting a proto package which streams are still associated with
+type PackageInUseError struct {
+	ProtoPackage string
+	Streams      []uuid.UUID
+}
+
+func (e *PackageInUseError) Error() string {
+	streams := make([]string, 0, len(e.Streams))
+	for _, streamUUID := range e.Streams {
+		streams = append(streams, streamUUID.String())
+	}
+	return fmt.Sprintf("proto package %s is still associated with %d stream(s): %s, delete the associations first or cascade", e.ProtoPackage, len(e.Streams), strings.Join(streams, ", "))
+}
+
+// streamsOf returns the streams associated with any version of a proto package, sorted. The caller must hold the lock.
+func (s *Store) streamsOf(protoPackage string) []uuid.UUID {
+	streams := make([]uuid.UUID, 0)
+	for streamUUID, association := range s.streamToSchema {
+		if association.ProtoPackage == protoPackage {
+			streams = append(streams, streamUUID)
+		}
 	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].String() < streams[j].String()
+	})
+	return streams
+}
+
+// DeleteProtoPackage removes every version of a proto package. It is refused while streams are still associated with
+// the package, unless the request cascades, in which case the associations are removed too.
+func (s *Server) DeleteProtoPackage(_ context.Context, req *DeleteSchemaRequest) error {
+	l := s.logger.WithField("protoPackage", req.ProtoPackage)
+
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if _, ok := s.store.schemas[req.ProtoPackage]; !ok {
+		err := fmt.Errorf("%w: %s", ErrProtoPackageNotFound, req.ProtoPackage)
+		l.WithError(err).Error("error deleting proto package")
+		return err
+	}
+
+	streams := s.store.streamsOf(req.ProtoPackage)
+	if len(streams) > 0 && !req.Cascade {
+		err := &PackageInUseError{ProtoPackage: req.ProtoPackage, Streams: streams}
+		l.WithError(err).Error("refusing to delete proto package")
+		return err
+	}
+	for _, streamUUID := range streams {
+		delete(s.store.streamToSchema, streamUUID)
+		l.WithField("streamUUID", streamUUID.String()).Info("association removed")
+	}
+
+	s.store.deleteProtoPackage(req.ProtoPackage)
+	l.Info("proto package removed")
+
+	return nil
+}
+
+// deleteProtoPackage removes a proto package, and forgets that any codeletset upserted it so that unloading the
+// codeletset later leaves alone a package stored again since. The caller must hold the write lock.
+func (s *Store) deleteProtoPackage(protoPackage string) {
+	delete(s.schemas, protoPackage)
+	for _, cs := range s.codeletsets {
+		delete(cs.packages, protoPackage)
+	}
+}
+
+// PruneProtoPackages removes every proto package which no stream is associated with, returning the removed packages
+func (s *Server) PruneProtoPackages(_ context.Context) []string {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	removed := make([]string, 0)
+	for protoPackage := range s.store.schemas {
+		if len(s.store.streamsOf(protoPackage)) == 0 {
+			removed = append(removed, protoPackage)
+		}
+	}
+	sort.Strings(removed)
+
+	for _, protoPackage := range removed {
+		s.store.deleteProtoPackage(protoPackage)
+		s.logger.WithField("protoPackage", protoPackage).Info("removed proto package with no associated streams")
+	}
+
+	return removed
 }
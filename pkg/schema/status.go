@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Status returns the stream associations grouped by codeletset, with the number of messages decoded for each stream,
+// only those of a codeletset if an ID is given. Codeletsets loaded as a whole are listed even if none of their streams
+// remain.
+func (s *Server) Status(_ context.Context, codeletsetID string) (*StatusResponse, error) {
+	s.store.mu.RLock()
+	defer s.store.mu.RUnlock()
+
+	codeletsets := make(map[string]*CodeletsetStatus)
+	for id := range s.store.codeletsets {
+		codeletsets[id] = &CodeletsetStatus{CodeletsetID: id, Streams: make([]*StreamStatus, 0)}
+	}
+	for streamUUID, association := range s.store.streamToSchema {
+		cs, ok := codeletsets[association.CodeletsetID]
+		if !ok {
+			cs = &CodeletsetStatus{CodeletsetID: association.CodeletsetID, Streams: make([]*StreamStatus, 0)}
+			codeletsets[association.CodeletsetID] = cs
+		}
+		cs.Streams = append(cs.Streams, &StreamStatus{
+			CodeletName:   association.CodeletName,
+			ProtoChecksum: association.checksum.String(),
+			ProtoMessage:  association.ProtoMsg,
+			ProtoPackage:  association.ProtoPackage,
+			StreamUUID:    streamUUID,
+			Decoded:       association.decoded.Load(),
+			Failed:        association.failed.Load(),
+		})
+	}
+
+	resp := &StatusResponse{
+		Codeletsets:           make([]*CodeletsetStatus, 0, len(codeletsets)),
+		UnknownStreamMessages: s.store.unknownStreamMessages.Load(),
+	}
+	for _, id := range sortedKeys(codeletsets) {
+		if len(codeletsetID) > 0 && id != codeletsetID {
+			continue
+		}
+		cs := codeletsets[id]
+		sort.Slice(cs.Streams, func(i, j int) bool {
+			return cs.Streams[i].StreamUUID.String() < cs.Streams[j].StreamUUID.String()
+		})
+		resp.Codeletsets = append(resp.Codeletsets, cs)
+	}
+	if len(codeletsetID) > 0 && len(resp.Codeletsets) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCodeletsetNotFound, codeletsetID)
+	}
+
+	return resp, nil
+}
@@ -1,67 +1,152 @@
 package schema
 
 import (
+	"encoding/base64"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protodesc"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+// Checksum identifies a version of a proto package, it is the sha1 of the serialized FileDescriptorSet
+type Checksum [20]byte
+
+func (c Checksum) String() string {
+	return base64.StdEncoding.EncodeToString(c[:])
+}
+
+// ParseChecksum parses a base64 encoded checksum
+func ParseChecksum(s string) (Checksum, error) {
+	var c Checksum
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if len(data) != len(c) {
+		return c, fmt.Errorf("expected a checksum of %d bytes, got %d", len(c), len(data))
+	}
+	copy(c[:], data)
+	return c, nil
+}
+
 // RecordedProtoDescriptor is a recorded proto descriptor
 type RecordedProtoDescriptor struct {
-	checksum        [20]byte
+	checksum        Checksum
+	files           *protoregistry.Files
 	ProtoDescriptor []byte
 }
 
+// RecordedProtoPackage holds the versions of a proto package which are in use
+type RecordedProtoPackage struct {
+	// path is the path of the file which declares the package, the last file of each version's FileDescriptorSet
+	path string
+	// latest is the most recently upserted version, which new associations are pinned to by default
+	latest   Checksum
+	versions map[Checksum]*RecordedProtoDescriptor
+}
+
 // RecordedStreamToSchema is a mapping of a stream to a schema
 type RecordedStreamToSchema struct {
+	checksum     Checksum
+	CodeletName  string
+	CodeletsetID string
 	ProtoMsg     string
 	ProtoPackage string
+
+	// decoded and failed count the messages received for the stream, they are updated under the read lock
+	decoded atomic.Uint64
+	failed  atomic.Uint64
 }
 
-// Store is an in memory store for protobuf schemas
+// Store is an in memory store for protobuf schemas, keyed by the identity returned by PackageID. Each proto package may
+// have several versions, so that streams emitting an older version can still be decoded after the package is upgraded.
 type Store struct {
-	schemas        map[string]*RecordedProtoDescriptor
+	mu             sync.RWMutex
+	codeletsets    map[string]*RecordedCodeletset
+	schemas        map[string]*RecordedProtoPackage
 	streamToSchema map[uuid.UUID]*RecordedStreamToSchema
+	// unknownStreamMessages counts the messages received for streams with no association
+	unknownStreamMessages atomic.Uint64
 }
 
 // NewStore returns a new Store
 func NewStore() *Store {
 	return &Store{
-		schemas:        make(map[string]*RecordedProtoDescriptor),
+		codeletsets:    make(map[string]*RecordedCodeletset),
+		schemas:        make(map[string]*RecordedProtoPackage),
 		streamToSchema: make(map[uuid.UUID]*RecordedStreamToSchema),
 	}
 }
 
 // GetProtoMsgInstance returns a new dynamic protobuf message instance
 func (s *Store) GetProtoMsgInstance(streamUUID uuid.UUID) (*dynamicpb.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	schema, ok := s.streamToSchema[streamUUID]
 	if !ok {
 		return nil, fmt.Errorf("no schema found for stream UUID %s", streamUUID.String())
 	}
 
-	sch, ok := s.schemas[schema.ProtoPackage]
+	return s.newMessage(schema)
+}
+
+// DecodedMessage is a message received for a stream, decoded with the schema the stream is associated with
+type DecodedMessage struct {
+	CodeletName  string
+	CodeletsetID string
+	Message      *dynamicpb.Message
+	StreamUUID   uuid.UUID
+}
+
+// Decode decodes a message received for a stream, counting it against the stream's association
+func (s *Store) Decode(streamUUID uuid.UUID, payload []byte) (*DecodedMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, ok := s.streamToSchema[streamUUID]
 	if !ok {
-		return nil, fmt.Errorf("no schema found for proto package %s", schema.ProtoPackage)
+		s.unknownStreamMessages.Add(1)
+		return nil, fmt.Errorf("no schema found for stream UUID %s", streamUUID.String())
 	}
 
-	fds := &descriptorpb.FileDescriptorSet{}
-	if err := proto.Unmarshal(sch.ProtoDescriptor, fds); err != nil {
-		return nil, err
+	msg, err := s.newMessage(schema)
+	if err == nil {
+		err = proto.Unmarshal(payload, msg)
 	}
-
-	pd, err := protodesc.NewFiles(fds)
 	if err != nil {
+		schema.failed.Add(1)
 		return nil, err
 	}
+	schema.decoded.Add(1)
+
+	return &DecodedMessage{
+		CodeletName:  schema.CodeletName,
+		CodeletsetID: schema.CodeletsetID,
+		Message:      msg,
+		StreamUUID:   streamUUID,
+	}, nil
+}
+
+// newMessage returns a new instance of the message of a stream association. The caller must hold the lock.
+func (s *Store) newMessage(schema *RecordedStreamToSchema) (*dynamicpb.Message, error) {
+	pkg, ok := s.schemas[schema.ProtoPackage]
+	if !ok {
+		return nil, fmt.Errorf("no schema found for proto package %s", schema.ProtoPackage)
+	}
+
+	sch, ok := pkg.versions[schema.checksum]
+	if !ok {
+		return nil, fmt.Errorf("no version %s found for proto package %s", schema.checksum, schema.ProtoPackage)
+	}
 
 	msgName := protoreflect.FullName(schema.ProtoMsg)
-	var desc protoreflect.Descriptor
-	desc, err = pd.FindDescriptorByName(msgName)
+	desc, err := sch.files.FindDescriptorByName(msgName)
 	if err != nil {
 		return nil, err
 	}
@@ -73,3 +158,28 @@ func (s *Store) GetProtoMsgInstance(streamUUID uuid.UUID) (*dynamicpb.Message, e
 
 	return dynamicpb.NewMessage(md), nil
 }
+
+// collectVersions removes the versions of a proto package, other than the latest, which no stream is associated with.
+// It returns the checksums of the removed versions. The caller must hold the write lock.
+func (s *Store) collectVersions(protoPackage string) []Checksum {
+	pkg, ok := s.schemas[protoPackage]
+	if !ok {
+		return nil
+	}
+
+	inUse := make(map[Checksum]bool)
+	for _, association := range s.streamToSchema {
+		if association.ProtoPackage == protoPackage {
+			inUse[association.checksum] = true
+		}
+	}
+
+	removed := make([]Checksum, 0)
+	for checksum := range pkg.versions {
+		if checksum != pkg.latest && !inUse[checksum] {
+			delete(pkg.versions, checksum)
+			removed = append(removed, checksum)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha1"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreVersions(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	v1 := compileSource(t, baseProto)
+	v2 := compileSource(t, replace(baseProto, "optional string name = 2;", "optional string label = 2;"))
+	oldStream, newStream := uuid.New(), uuid.New()
+
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: oldStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v2}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: newStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 2)
+
+	fieldName := func(streamUUID uuid.UUID) string {
+		msg, err := store.GetProtoMsgInstance(streamUUID)
+		require.NoError(t, err)
+		return string(msg.Descriptor().Fields().ByNumber(2).Name())
+	}
+	assert.Equal(t, "name", fieldName(oldStream))
+	assert.Equal(t, "label", fieldName(newStream))
+
+	// the old version is collected once no stream is associated with it
+	s.DeleteStreamToSchemaAssociation(ctx, oldStream)
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 1)
+	assert.Equal(t, "label", fieldName(newStream))
+
+	// streams can be pinned to a specific version
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	v2Checksum := Checksum(sha1.Sum(v2))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: oldStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg", ProtoChecksum: v2Checksum.String()}))
+	assert.Equal(t, "label", fieldName(oldStream))
+
+	// re-associating a stream moves it to the new version
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: oldStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: newStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	assert.Equal(t, "name", fieldName(oldStream))
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 1)
+
+	err := s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: oldStream, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg", ProtoChecksum: v2Checksum.String()})
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestDeleteProtoPackage(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileSource(t, baseProto)}))
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileFile(t, "other.proto", "syntax = \"proto2\";\npackage other;\nmessage msg { optional int32 x = 1; }\n")}))
+	streams := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, streamUUID := range streams {
+		require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: streamUUID, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	}
+
+	err := s.DeleteProtoPackage(ctx, &DeleteSchemaRequest{ProtoPackage: "missing"})
+	assert.ErrorIs(t, err, ErrProtoPackageNotFound)
+
+	// packages are not removed while streams are associated with them, unless cascading
+	err = s.DeleteProtoPackage(ctx, &DeleteSchemaRequest{ProtoPackage: "pkg:pkg.proto"})
+	var inUseErr *PackageInUseError
+	require.ErrorAs(t, err, &inUseErr)
+	assert.ElementsMatch(t, streams, inUseErr.Streams)
+	assert.Len(t, store.schemas, 2)
+
+	s.DeleteStreamToSchemaAssociation(ctx, streams[0])
+	require.NoError(t, s.DeleteProtoPackage(ctx, &DeleteSchemaRequest{ProtoPackage: "pkg:pkg.proto", Cascade: true}))
+	assert.Len(t, store.schemas, 1)
+	assert.Empty(t, store.streamToSchema)
+
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: compileSource(t, baseProto)}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: streams[0], ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	assert.Equal(t, []string{"other:other.proto"}, s.PruneProtoPackages(ctx))
+	assert.Len(t, store.schemas, 1)
+	assert.Empty(t, s.PruneProtoPackages(ctx))
+}
+
+func TestDeleteProtoPackageOfCodeletset(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	s := NewServer(ctx, logrus.New(), &Options{}, store)
+
+	v1 := compileSource(t, baseProto)
+	v2 := compileSource(t, replace(baseProto, "optional string name = 2;", "optional string label = 2;"))
+	other := compileFile(t, "other.proto", "syntax = \"proto2\";\npackage other;\nmessage msg { optional int32 x = 1; }\n")
+	pinned := uuid.New()
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.LoadCodeletset(ctx, &LoadCodeletsetRequest{
+		CodeletsetID:  "cs",
+		ProtoPackages: []*UpsertSchemaRequest{{ProtoDescriptor: v2}, {ProtoDescriptor: other}},
+		Streams:       []*AddSchemaAssociationRequest{{StreamUUID: uuid.New(), ProtoPackage: "other:other.proto", ProtoMessage: "other.msg"}},
+	}))
+
+	// both packages are deleted, then stored again by other requests
+	require.NoError(t, s.DeleteProtoPackage(ctx, &DeleteSchemaRequest{ProtoPackage: "other:other.proto", Cascade: true}))
+	assert.Equal(t, []string{"pkg:pkg.proto"}, s.PruneProtoPackages(ctx))
+	assert.Empty(t, store.codeletsets["cs"].packages)
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: other}))
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v1}))
+	require.NoError(t, s.AddStreamToSchemaAssociation(ctx, &AddSchemaAssociationRequest{StreamUUID: pinned, ProtoPackage: "pkg:pkg.proto", ProtoMessage: "pkg.msg"}))
+	require.NoError(t, s.UpsertProtoPackage(ctx, &UpsertSchemaRequest{ProtoDescriptor: v2}))
+
+	// unloading the codeletset neither removes them nor reverts to the version before it was loaded
+	require.NoError(t, s.UnloadCodeletset(ctx, "cs"))
+	assert.Contains(t, store.schemas, "other:other.proto")
+	require.Contains(t, store.schemas, "pkg:pkg.proto")
+	assert.Equal(t, Checksum(sha1.Sum(v2)), store.schemas["pkg:pkg.proto"].latest)
+	assert.Len(t, store.schemas["pkg:pkg.proto"].versions, 2)
+}